@@ -0,0 +1,93 @@
+package display
+
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Predefined textures that can be used with your shader through
+// [LinkShaderAutoTexture](). They are generated on the CPU when first
+// used.
+//
+// Fixed size images have a number at the end of their name.
+// Resizable images will be resized to the canvas size (and
+// regenerated whenever the canvas size changes).
+type AutoTexture uint8
+const (
+	TexTriangleRed AutoTexture = iota // red triangle on a transparent background
+	TexTriangleCyan // cyan triangle on a transparent background
+	TexTriangleColor // triangle with red, green and blue corners
+	TexNoiseMono // opaque grayscale white noise
+	TexNoiseColor // opaque color white noise
+
+	texFixedAnchor // unexported for internal use (resizable above, fixed size below)
+	TexNoiseMono32x32 // tileable grayscale value noise
+	TexEbiten32x32 // a fried shrimp (ebiten), pixel art
+	TexSprite32x32 // a slime character, pixel art
+	TexAniSprite32x32 // 4-frame sprite sheet of a bouncing slime (128x32)
+	TexSphereAlbedo256x256 // see [ImageSphere]()
+	TexSphereNormals256x256
+	TexSphereMask256x256
+	TexTeapotAlbedo256x256 // see [ImageTeapot]()
+	TexTeapotNormals256x256
+	TexTeapotMask256x256
+	TexBrickWallAlbedo256x256 // see [ImageBrickWall]()
+	TexBrickWallNormals256x256
+	TexBrickWallMask256x256
+)
+
+// Returns whether the texture is resized to the canvas size.
+func (self AutoTexture) Resizable() bool {
+	return self < texFixedAnchor
+}
+
+// Generates the texture on the CPU. The width and height are only
+// used for resizable textures. The returned image must not be modified,
+// as it may be shared with later calls.
+func (self AutoTexture) Generate(width, height int) *image.RGBA {
+	switch self {
+	case TexTriangleRed   : return genTriangle(width, height, triangleRed)
+	case TexTriangleCyan  : return genTriangle(width, height, triangleCyan)
+	case TexTriangleColor : return genTriangle(width, height, triangleColor)
+	case TexNoiseMono     : return genNoise(width, height, false)
+	case TexNoiseColor    : return genNoise(width, height, true)
+	case TexNoiseMono32x32: return genValueNoise(32, 32, 8)
+	case TexEbiten32x32   : return genPixelArt(ebitenArt, ebitenPalette, 2)
+	case TexSprite32x32   : return genSlimeSheet(1)
+	case TexAniSprite32x32: return genSlimeSheet(4)
+	case TexSphereAlbedo256x256    : return getLitObject(litSphere).albedo
+	case TexSphereNormals256x256   : return getLitObject(litSphere).normals
+	case TexSphereMask256x256      : return getLitObject(litSphere).mask
+	case TexTeapotAlbedo256x256    : return getLitObject(litTeapot).albedo
+	case TexTeapotNormals256x256   : return getLitObject(litTeapot).normals
+	case TexTeapotMask256x256      : return getLitObject(litTeapot).mask
+	case TexBrickWallAlbedo256x256 : return getLitObject(litBrickWall).albedo
+	case TexBrickWallNormals256x256: return getLitObject(litBrickWall).normals
+	case TexBrickWallMask256x256   : return getLitObject(litBrickWall).mask
+	default:
+		panic("invalid AutoTexture")
+	}
+}
+
+type autoTexEntry struct {
+	width, height int
+	image *ebiten.Image
+}
+var autoTexCache map[AutoTexture]autoTexEntry
+
+// Returns the texture as an *ebiten.Image, generating it if necessary.
+// Resizable textures are regenerated if the canvas size has changed.
+func getAutoTexture(tex AutoTexture, canvas image.Rectangle) *ebiten.Image {
+	width, height := canvas.Dx(), canvas.Dy()
+	entry, found := autoTexCache[tex]
+	if found && (!tex.Resizable() || (entry.width == width && entry.height == height)) {
+		return entry.image
+	}
+
+	if found { entry.image.Dispose() }
+	img := ebiten.NewImageFromImage(tex.Generate(width, height))
+	if autoTexCache == nil {
+		autoTexCache = make(map[AutoTexture]autoTexEntry, 1)
+	}
+	autoTexCache[tex] = autoTexEntry{ width, height, img }
+	return img
+}
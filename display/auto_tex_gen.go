@@ -0,0 +1,208 @@
+package display
+
+import "math"
+import "image"
+import "image/color"
+
+// CPU generators for the AutoTexture set. Everything here is
+// deterministic, so regenerating a texture gives the same result.
+
+var (
+	triangleRed   = [3]color.RGBA{{255, 0, 0, 255}, {255, 0, 0, 255}, {255, 0, 0, 255}}
+	triangleCyan  = [3]color.RGBA{{0, 255, 255, 255}, {0, 255, 255, 255}, {0, 255, 255, 255}}
+	triangleColor = [3]color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}}
+)
+
+// Generates a triangle pointing up on a transparent background, with
+// the given top, bottom-left and bottom-right vertex colors. Edges are
+// antialiased with 4x4 supersampling.
+func genTriangle(width, height int, colors [3]color.RGBA) *image.RGBA {
+	const samples = 4
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	w, h := float64(width), float64(height)
+	ax, ay := w*0.50, h*0.10 // top
+	bx, by := w*0.10, h*0.90 // bottom-left
+	cx, cy := w*0.90, h*0.90 // bottom-right
+	area := (bx - ax)*(cy - ay) - (by - ay)*(cx - ax)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b, coverage float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					px := float64(x) + (float64(sx) + 0.5)/samples
+					py := float64(y) + (float64(sy) + 0.5)/samples
+					wa := ((bx - px)*(cy - py) - (by - py)*(cx - px))/area
+					wb := ((cx - px)*(ay - py) - (cy - py)*(ax - px))/area
+					wc := 1.0 - wa - wb
+					if wa < 0 || wb < 0 || wc < 0 { continue }
+					r += wa*float64(colors[0].R) + wb*float64(colors[1].R) + wc*float64(colors[2].R)
+					g += wa*float64(colors[0].G) + wb*float64(colors[1].G) + wc*float64(colors[2].G)
+					b += wa*float64(colors[0].B) + wb*float64(colors[1].B) + wc*float64(colors[2].B)
+					coverage += 1
+				}
+			}
+			if coverage == 0 { continue }
+			const n = samples*samples // (premultiplied result)
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(math.Round(r/n)), uint8(math.Round(g/n)), uint8(math.Round(b/n)),
+				uint8(math.Round(255*coverage/n)),
+			})
+		}
+	}
+	return img
+}
+
+// Generates opaque white noise.
+func genNoise(width, height int, colored bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			hash := mix64(uint64(x) | uint64(y) << 32)
+			r := uint8(hash)
+			g, b := r, r
+			if colored { g, b = uint8(hash >> 8), uint8(hash >> 16) }
+			img.SetRGBA(x, y, color.RGBA{r, g, b, 255})
+		}
+	}
+	return img
+}
+
+// Generates tileable grayscale value noise with two octaves. The
+// width and height must be multiples of the cell size.
+func genValueNoise(width, height int, cellSize int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	octave := func(x, y int, cellSize int, seed uint64) float64 {
+		cols, rows := width/cellSize, height/cellSize
+		fx := float64(x)/float64(cellSize)
+		fy := float64(y)/float64(cellSize)
+		x0, y0 := int(fx), int(fy)
+		tx, ty := smoothstep(fx - float64(x0)), smoothstep(fy - float64(y0))
+		value := func(col, row int) float64 {
+			col, row = col % cols, row % rows // wrap for tiling
+			return float64(mix64(seed ^ uint64(col) ^ uint64(row) << 32) >> 11)/float64(1 << 53)
+		}
+		top := lerp(value(x0, y0    ), value(x0 + 1, y0    ), tx)
+		bot := lerp(value(x0, y0 + 1), value(x0 + 1, y0 + 1), tx)
+		return lerp(top, bot, ty)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := octave(x, y, cellSize, 0x51)*0.66 + octave(x, y, cellSize/2, 0x52)*0.34
+			level := uint8(math.Round(value*255))
+			img.SetRGBA(x, y, color.RGBA{level, level, level, 255})
+		}
+	}
+	return img
+}
+
+var ebitenPalette = map[byte]color.RGBA{
+	'.': {  0,   0,   0,   0},
+	'k': { 72,  36,  16, 255}, // outline
+	'o': {214, 140,  40, 255}, // batter
+	'O': {250, 196,  84, 255}, // batter highlight
+	'r': {168,  24,  24, 255}, // tail shadow
+	'R': {240,  64,  48, 255}, // tail
+}
+
+var ebitenArt = []string{
+	"................",
+	"...........kkk..",
+	"..........kOOOk.",
+	".........kOOoOk.",
+	"........kOOoOok.",
+	".......kOOoOok..",
+	"......kOOoOok...",
+	".....kOOoOok....",
+	"....kOOoOok.....",
+	"...kOOoOok......",
+	"..kOoOook.......",
+	".kRkoook........",
+	"kRRrkkk.........",
+	"kRrRk...........",
+	".kkk............",
+	"................",
+}
+
+// Generates an image from pixel art defined as a list of strings,
+// with each pixel scaled by the given factor.
+func genPixelArt(art []string, palette map[byte]color.RGBA, scale int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(art[0])*scale, len(art)*scale))
+	for row, line := range art {
+		if len(line) != len(art[0]) { panic("inconsistent pixel art row length") }
+		for col := 0; col < len(line); col++ {
+			clr, found := palette[line[col]]
+			if !found { panic("missing pixel art palette entry for '" + string(line[col]) + "'") }
+			for y := row*scale; y < (row + 1)*scale; y++ {
+				for x := col*scale; x < (col + 1)*scale; x++ {
+					img.SetRGBA(x, y, clr)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// Generates a sprite sheet with the given number of 32x32 frames
+// of a slime bouncing, laid out horizontally. With a single frame,
+// the slime is in its neutral pose.
+func genSlimeSheet(frames int) *image.RGBA {
+	const size = 32
+	img := image.NewRGBA(image.Rect(0, 0, size*frames, size))
+	outline   := color.RGBA{ 24,  64,  32, 255}
+	body      := color.RGBA{ 96, 200,  96, 255}
+	highlight := color.RGBA{220, 255, 220, 255}
+	for frame := 0; frame < frames; frame++ {
+		// squash and stretch
+		phase := 2*math.Pi*float64(frame)/float64(frames)
+		squash := math.Sin(phase)
+		rx, ry := 11.0 + 2.0*squash, 9.0 - 2.0*squash
+		hop := math.Max(0, -math.Cos(phase))*3.0
+		if frames == 1 { rx, ry, hop = 11, 9, 0 }
+		bottom := 29.0 - hop
+		cx, cy := 16.0, bottom - ry*0.7
+
+		inside := func(x, y int) bool {
+			px, py := float64(x) + 0.5, float64(y) + 0.5
+			dx, dy := (px - cx)/rx, (py - cy)/ry
+			return dx*dx + dy*dy <= 1 && py <= bottom
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				if !inside(x, y) { continue }
+				clr := body
+				if !inside(x - 1, y) || !inside(x + 1, y) || !inside(x, y - 1) || !inside(x, y + 1) {
+					clr = outline
+				} else if math.Hypot(float64(x) + 0.5 - (cx - rx*0.45), float64(y) + 0.5 - (cy - ry*0.45)) < 1.6 {
+					clr = highlight
+				}
+				img.SetRGBA(frame*size + x, y, clr)
+			}
+		}
+
+		// eyes
+		for _, eyeX := range []int{int(cx) - 4, int(cx) + 3} {
+			for y := int(cy) - 1; y <= int(cy) + 1; y++ {
+				img.SetRGBA(frame*size + eyeX, y, outline)
+			}
+		}
+	}
+	return img
+}
+
+// A good 64-bit mixing function (splitmix64 finalizer).
+func mix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30))*0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27))*0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+func smoothstep(t float64) float64 {
+	return t*t*(3 - 2*t)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b - a)*t
+}
@@ -0,0 +1,193 @@
+package display
+
+import "sync"
+import "math"
+import "image"
+import "image/color"
+
+// CPU generators for the albedo + normal map + mask texture sets.
+//
+// Objects are defined by a signed distance function (positive inside,
+// in pixels) and a bevel size. The height at each point is a circular
+// profile of the distance up to the bevel size, so a circle with a
+// bevel equal to its radius becomes a perfect hemisphere.
+//
+// Normal maps encode normals as (n + 1)/2, with x pointing right, y
+// pointing up and z pointing towards the viewer. They are opaque,
+// with flat normals outside the objects.
+
+const litObjectSize = 256
+
+type litObjectID uint8
+const (
+	litSphere litObjectID = iota
+	litTeapot
+	litBrickWall
+)
+
+type litObject struct {
+	albedo *image.RGBA
+	normals *image.RGBA
+	mask *image.RGBA
+}
+
+var litObjectCache [3]*litObject
+var litObjectMutex sync.Mutex
+
+func getLitObject(id litObjectID) *litObject {
+	litObjectMutex.Lock()
+	defer litObjectMutex.Unlock()
+	if litObjectCache[id] == nil {
+		switch id {
+		case litSphere   : litObjectCache[id] = genSphere(litObjectSize)
+		case litTeapot   : litObjectCache[id] = genTeapot(litObjectSize)
+		case litBrickWall: litObjectCache[id] = genBrickWall(litObjectSize)
+		default:
+			panic("invalid lit object")
+		}
+	}
+	return litObjectCache[id]
+}
+
+// Generates a lit object from the given signed distance function,
+// bevel size and albedo function. The albedo function receives the
+// pixel coordinates and the normal, and returns an opaque color. If
+// opaque is true, the albedo is also used outside the object.
+func genLitObject(size int, sdf func(x, y float64) float64, bevel float64, opaque bool, albedo func(x, y int, nx, ny, nz float64) color.RGBA) *litObject {
+	object := &litObject{
+		albedo: image.NewRGBA(image.Rect(0, 0, size, size)),
+		normals: image.NewRGBA(image.Rect(0, 0, size, size)),
+		mask: image.NewRGBA(image.Rect(0, 0, size, size)),
+	}
+
+	const eps = 0.5
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			px, py := float64(x) + 0.5, float64(y) + 0.5
+			dist := sdf(px, py)
+			coverage := clampUnit(dist + 0.5)
+
+			// normal from the distance gradient and the bevel profile
+			nx, ny, nz := 0.0, 0.0, 1.0
+			if dist > -0.5 {
+				gx := (sdf(px + eps, py) - sdf(px - eps, py))/(2*eps)
+				gy := (sdf(px, py + eps) - sdf(px, py - eps))/(2*eps)
+				t := math.Max(0, math.Min(dist, bevel))
+				height := math.Sqrt(math.Max(0, bevel*bevel - (bevel - t)*(bevel - t)))
+				// outward direction is -gradient, and y must be flipped
+				nx, ny, nz = -(bevel - t)*gx, (bevel - t)*gy, height
+				length := math.Sqrt(nx*nx + ny*ny + nz*nz)
+				if length == 0 {
+					nx, ny, nz = 0, 0, 1
+				} else {
+					nx, ny, nz = nx/length, ny/length, nz/length
+				}
+			}
+			object.normals.SetRGBA(x, y, color.RGBA{
+				toU8((nx + 1)/2), toU8((ny + 1)/2), toU8((nz + 1)/2), 255,
+			})
+			alpha := toU8(coverage)
+			object.mask.SetRGBA(x, y, color.RGBA{alpha, alpha, alpha, alpha})
+			if opaque {
+				object.albedo.SetRGBA(x, y, albedo(x, y, nx, ny, nz))
+			} else if coverage > 0 {
+				clr := albedo(x, y, nx, ny, nz)
+				object.albedo.SetRGBA(x, y, color.RGBA{ // premultiply
+					toU8(float64(clr.R)/255*coverage), toU8(float64(clr.G)/255*coverage),
+					toU8(float64(clr.B)/255*coverage), alpha,
+				})
+			}
+		}
+	}
+	return object
+}
+
+// A sphere with beach ball colors.
+func genSphere(size int) *litObject {
+	center := float64(size)/2
+	radius := float64(size)*0.45
+	sdf := func(x, y float64) float64 {
+		return radius - math.Hypot(x - center, y - center)
+	}
+	stripes := []color.RGBA{
+		{226, 52, 48, 255}, {245, 245, 240, 255}, {40, 96, 200, 255},
+		{245, 245, 240, 255}, {250, 200, 40, 255}, {245, 245, 240, 255},
+	}
+	albedo := func(_, _ int, nx, ny, nz float64) color.RGBA {
+		if ny > 0.94 { return stripes[1] } // top cap
+		longitude := math.Atan2(nx, nz) + math.Pi
+		index := int(longitude/(2*math.Pi)*float64(len(stripes)*2)) % len(stripes)
+		return stripes[index]
+	}
+	return genLitObject(size, sdf, radius, false, albedo)
+}
+
+// A 2D teapot made of a few simple shapes.
+func genTeapot(size int) *litObject {
+	s := float64(size)/256 // all shapes defined for a 256x256 size
+	ellipse := func(x, y, cx, cy, rx, ry float64) float64 {
+		dx, dy := (x - cx)/rx, (y - cy)/ry
+		return (1 - math.Sqrt(dx*dx + dy*dy))*math.Min(rx, ry)
+	}
+	capsule := func(x, y, ax, ay, bx, by, radius float64) float64 {
+		abx, aby := bx - ax, by - ay
+		t := clampUnit(((x - ax)*abx + (y - ay)*aby)/(abx*abx + aby*aby))
+		return radius - math.Hypot(x - (ax + abx*t), y - (ay + aby*t))
+	}
+	ring := func(x, y, cx, cy, radius, width float64) float64 {
+		return width/2 - math.Abs(math.Hypot(x - cx, y - cy) - radius)
+	}
+
+	body := func(x, y float64) float64 { return ellipse(x, y, 128*s, 150*s, 78*s, 62*s) }
+	lid  := func(x, y float64) float64 { return ellipse(x, y, 128*s, 90*s, 40*s, 14*s) }
+	knob := func(x, y float64) float64 { return ellipse(x, y, 128*s, 72*s, 10*s, 9*s) }
+	sdf := func(x, y float64) float64 {
+		dist := body(x, y)
+		dist = math.Max(dist, lid(x, y))
+		dist = math.Max(dist, knob(x, y))
+		dist = math.Max(dist, capsule(x, y, 178*s, 160*s, 226*s, 104*s, 11*s)) // spout
+		dist = math.Max(dist, ring(x, y, 52*s, 146*s, 30*s, 14*s)) // handle
+		return dist
+	}
+
+	porcelain := color.RGBA{232, 236, 240, 255}
+	blue := color.RGBA{ 44,  90, 176, 255}
+	albedo := func(x, y int, _, _, _ float64) color.RGBA {
+		px, py := float64(x) + 0.5, float64(y) + 0.5
+		if knob(px, py) > 0 { return blue }
+		if body(px, py) > 0 && math.Abs(py - 150*s) < 7*s { return blue }
+		return porcelain
+	}
+	return genLitObject(size, sdf, 18*s, false, albedo)
+}
+
+// A tileable brick wall with a running bond pattern. The albedo is
+// opaque, but the mask only covers the bricks, not the mortar.
+func genBrickWall(size int) *litObject {
+	const brickWidth, brickHeight, mortar = 64, 32, 4
+	brickAt := func(x, y float64) (int, int, float64) {
+		row := int(math.Floor(y/brickHeight))
+		offset := float64(row % 2)*brickWidth/2
+		col := int(math.Floor((x + offset)/brickWidth))
+		// distance to the brick edges, including half the mortar on each side
+		lx := math.Mod(x + offset, brickWidth)
+		ly := math.Mod(y, brickHeight)
+		dist := math.Min(math.Min(lx, brickWidth - lx), math.Min(ly, brickHeight - ly)) - mortar/2
+		return col, row, dist
+	}
+	sdf := func(x, y float64) float64 {
+		_, _, dist := brickAt(x, y)
+		return dist
+	}
+	albedo := func(x, y int, _, _, _ float64) color.RGBA {
+		col, row, dist := brickAt(float64(x) + 0.5, float64(y) + 0.5)
+		if dist <= 0 { return color.RGBA{168, 162, 150, 255} } // mortar
+		col = ((col % (size/brickWidth)) + size/brickWidth) % (size/brickWidth) // keep tileable
+		hash := mix64(uint64(col) | uint64(row) << 32)
+		shade := 0.85 + 0.3*float64(hash & 0xFF)/255.0
+		return color.RGBA{
+			toU8(0.62*shade), toU8(0.26*shade), toU8(0.18*shade), 255,
+		}
+	}
+	return genLitObject(size, sdf, 4, true, albedo)
+}
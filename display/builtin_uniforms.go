@@ -0,0 +1,91 @@
+package display
+
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/inpututil"
+
+// Uniforms that are always set by [Shader]().
+var coreBuiltinUniforms = []string{ "Time", "Cursor", "MouseButtons" }
+
+// Uniforms that are set by [Shader]() only if the shader declares them.
+var optionalBuiltinUniforms = []string{
+	"Tick", "Frame", "DeltaTime", "LastClickPos", "BackColor", "Resolution",
+}
+
+// Panics if the given name corresponds to one of the uniforms
+// that are set automatically by [Shader]().
+func assertNotBuiltinUniform(name string) {
+	for _, builtin := range coreBuiltinUniforms {
+		if name == builtin { panic("can't override '" + name + "' uniform") }
+	}
+	for _, builtin := range optionalBuiltinUniforms {
+		if name == builtin { panic("can't override '" + name + "' uniform") }
+	}
+}
+
+// State for the optional built-in uniforms.
+type builtinState struct {
+	tick int // updates since start
+	frame int // draws since start
+	lastDrawTime float32 // value of Time on the previous draw
+	lastClickPos [2]float32 // normalized, like Cursor
+}
+
+// Must be called on every Update() to keep track of ticks and clicks.
+func (self *builtinState) Update(bounds image.Rectangle) {
+	self.tick += 1
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && !bounds.Empty() {
+		x, y := ebiten.CursorPosition()
+		nx := minf64(maxf64(float64(x - bounds.Min.X), 0), float64(bounds.Dx()))/float64(bounds.Dx())
+		ny := minf64(maxf64(float64(y - bounds.Min.Y), 0), float64(bounds.Dy()))/float64(bounds.Dy())
+		self.lastClickPos = [2]float32{ float32(nx), float32(ny) }
+	}
+}
+
+// Sets the optional built-in uniforms declared by the program on the
+// given map, and deletes the ones not declared (in case they were
+// declared on a previous version of the shader). The "Time" uniform
+// must already be set.
+func (self *builtinState) Set(uniforms map[string]any, declared map[string]string, bounds image.Rectangle) {
+	seconds, _ := uniforms["Time"].(float32)
+	for _, name := range optionalBuiltinUniforms {
+		typeName, found := declared[name]
+		if !found {
+			delete(uniforms, name)
+			continue
+		}
+
+		switch name {
+		case "Tick":
+			uniforms[name] = numericUniform(self.tick, typeName)
+		case "Frame":
+			uniforms[name] = numericUniform(self.frame, typeName)
+		case "DeltaTime":
+			var delta float32
+			if self.frame > 0 { delta = seconds - self.lastDrawTime }
+			uniforms[name] = delta
+		case "LastClickPos":
+			uniforms[name] = []float32{ self.lastClickPos[0], self.lastClickPos[1] }
+		case "BackColor":
+			r, g, b, a := winBackColor.RGBA() // premultiplied
+			uniforms[name] = []float32{
+				float32(r)/65535.0, float32(g)/65535.0, float32(b)/65535.0, float32(a)/65535.0,
+			}
+		case "Resolution":
+			uniforms[name] = []float32{ float32(bounds.Dx()), float32(bounds.Dy()) }
+		default:
+			panic("unreachable")
+		}
+	}
+
+	self.frame += 1
+	self.lastDrawTime = seconds
+}
+
+// Ebitengine converts ints to floats, but not the other way around,
+// so we need to respect the declared type.
+func numericUniform(value int, typeName string) any {
+	if typeName == "int" { return value }
+	return float32(value)
+}
@@ -39,6 +39,6 @@
 // please refer to [Shader]() for more details on all that.
 //
 // Finally, the package also detects some flags like '--maxfps' (unlimit fps and
-// display them on the title), '--fullscreen' and '--opengl' (Windows would use
-// DirectX by default otherwise).
+// display them on the title), '--fullscreen', '--opengl' (Windows would use
+// DirectX by default otherwise) and '--compare=other.kage' (see [CompareShaders]()).
 package display
@@ -3,6 +3,7 @@ package display
 import _ "embed"
 import "image/png"
 import "bytes"
+import "image"
 
 import "github.com/hajimehoshi/ebiten/v2"
 
@@ -39,3 +40,28 @@ func ImageWaterfall() *ebiten.Image {
 	return imageWaterfall
 }
 
+// Returns a 256x256 sphere with beach ball colors as an albedo texture,
+// its normal map and its alpha mask. Useful for testing lighting shaders.
+//
+// Normal maps encode normals as (n + 1)/2, with x pointing right, y
+// pointing up and z pointing towards the viewer. They are opaque, with
+// flat normals outside the objects.
+func ImageSphere() (albedo, normals, mask *ebiten.Image) {
+	return getAutoTextureTriplet(TexSphereAlbedo256x256)
+}
+
+// Like [ImageSphere](), but with a 2D teapot instead.
+func ImageTeapot() (albedo, normals, mask *ebiten.Image) {
+	return getAutoTextureTriplet(TexTeapotAlbedo256x256)
+}
+
+// Like [ImageSphere](), but with a tileable brick wall instead. The
+// albedo is fully opaque, but the mask only covers the bricks.
+func ImageBrickWall() (albedo, normals, mask *ebiten.Image) {
+	return getAutoTextureTriplet(TexBrickWallAlbedo256x256)
+}
+
+func getAutoTextureTriplet(first AutoTexture) (*ebiten.Image, *ebiten.Image, *ebiten.Image) {
+	var noCanvas image.Rectangle // (fixed size textures)
+	return getAutoTexture(first, noCanvas), getAutoTexture(first + 1, noCanvas), getAutoTexture(first + 2, noCanvas)
+}
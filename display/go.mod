@@ -2,13 +2,15 @@ module github.com/tinne26/kage-desk/display
 
 go 1.19
 
-require github.com/hajimehoshi/ebiten/v2 v2.6.0
+require (
+	github.com/hajimehoshi/ebiten/v2 v2.6.0
+	golang.org/x/image v0.16.0
+)
 
 require (
 	github.com/ebitengine/purego v0.7.0 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
 	golang.org/x/exp/shiny v0.0.0-20230817173708-d852ddb80c63 // indirect
-	golang.org/x/image v0.16.0 // indirect
 	golang.org/x/mobile v0.0.0-20230922142353-e2f452493d57 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,198 @@
+package display
+
+import "fmt"
+import "image"
+import "errors"
+import "sync"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// The runner of the current RunHeadless() call, nil if not running.
+// Accessed from multiple goroutines, so it's guarded by a mutex.
+var headless *headlessRunner
+var headlessMutex sync.Mutex
+
+// Runs the given function while an Ebitengine game loop is kept
+// running on the background, which is required for [RenderShaderToImage]()
+// to work. Returns the function's result, or 1 if the game loop
+// failed. This is mainly intended for tests and CI:
+//
+//   func TestMain(m *testing.M) {
+//       os.Exit(display.RunHeadless(m.Run))
+//   }
+//
+// Despite the name, this is not a true headless mode: Ebitengine needs
+// a window to run, so a tiny 32x32 undecorated and unfocused window is
+// opened while the function runs. On machines without a display (e.g.
+// most CI runners on Linux), this requires a virtual one, like Xvfb
+// ('xvfb-run go test ./...'). If that's not an option, the kagecpu
+// subpackage can render shaders on the CPU without any window nor GPU.
+// See examples/misc/headless-test for a complete example.
+//
+// Like [Shader]() or [Image](), this must be called from the main
+// goroutine, and only once per program.
+func RunHeadless(fn func() int) int {
+	runner := &headlessRunner{
+		jobs: make(chan func()),
+		done: make(chan int, 1),
+		stopped: make(chan struct{}),
+	}
+	headlessMutex.Lock()
+	if headless != nil {
+		headlessMutex.Unlock()
+		panic("RunHeadless() is already running")
+	}
+	headless = runner
+	headlessMutex.Unlock()
+	defer func() {
+		headlessMutex.Lock()
+		headless = nil
+		headlessMutex.Unlock()
+		close(runner.stopped)
+	}()
+
+	go func() { runner.done <- fn() }()
+
+	ebiten.SetWindowTitle("kage-desk/display (headless)")
+	ebiten.SetWindowDecorated(false)
+	ebiten.SetWindowSize(32, 32)
+	ebiten.SetRunnableOnUnfocused(true)
+	err := ebiten.RunGameWithOptions(runner, &ebiten.RunGameOptions{
+		InitUnfocused: true,
+		SkipTaskbar: true,
+	})
+	if err != nil {
+		fmt.Printf("kage-desk/display error: RunHeadless() game loop failed: %s\n", err.Error())
+		return 1
+	}
+	return runner.exitCode
+}
+
+type headlessRunner struct {
+	jobs chan func()
+	done chan int
+	stopped chan struct{} // closed when the game loop is over
+	exitCode int
+}
+
+func (self *headlessRunner) Layout(_, _ int) (int, int) { return 32, 32 }
+func (self *headlessRunner) Draw(*ebiten.Image) {}
+func (self *headlessRunner) Update() error {
+	for {
+		select {
+		case job := <-self.jobs:
+			job()
+		case exitCode := <-self.done:
+			self.exitCode = exitCode
+			return ebiten.Termination
+		default:
+			return nil
+		}
+	}
+}
+
+// Renders the given shader program to an image of the given size,
+// with the same uniforms and images setup that [Shader]() uses.
+// Requires [RunHeadless]() to be running, and can be called from any
+// goroutine. Notice that this is not window-less: the rendering goes
+// through the small window that RunHeadless() opens.
+//
+// The Time uniform is zero and the Cursor is at (0, 0) unless you
+// pass them explicitly. The given uniforms take precedence over
+// built-in uniforms, comment macros and uniforms linked from Go. Nil
+// images are replaced by the default images if the shader uses them,
+// like with [LinkShaderImage](), and they are mapped according to
+// [SetShaderImageMapping](). The result has premultiplied alpha.
+//
+// Uniform values are converted to the declared types when possible
+// (e.g. int to float, or []float64 to []float32), and an error is
+// returned otherwise. Compilation errors are returned as a [ShaderErrorList].
+func RenderShaderToImage(program []byte, width, height int, uniforms map[string]any, images [4]image.Image) (*image.RGBA, error) {
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("invalid render size %dx%d", width, height)
+	}
+	headlessMutex.Lock()
+	runner := headless
+	headlessMutex.Unlock()
+	if runner == nil {
+		return nil, errors.New("RenderShaderToImage() requires RunHeadless() to be running")
+	}
+
+	var rgba *image.RGBA
+	var err error
+	done := make(chan struct{})
+	job := func() {
+		defer close(done)
+		defer func() { // (e.g. uniforms with wrong lengths)
+			recovered := recover()
+			if recovered != nil { err = fmt.Errorf("render failed: %v", recovered) }
+		}()
+		rgba, err = renderShaderToImage(program, width, height, uniforms, images)
+	}
+	select {
+	case runner.jobs <- job:
+		<-done
+		return rgba, err
+	case <-runner.stopped:
+		return nil, errors.New("RunHeadless() stopped before the render could start")
+	}
+}
+
+// Must be called from the game loop.
+func renderShaderToImage(program []byte, width, height int, uniforms map[string]any, images [4]image.Image) (*image.RGBA, error) {
+	shader, source, err := compileShader(program, "")
+	if err != nil { return nil, err }
+	program = source.program
+
+	// create a temporary displayer with the given images
+	var fixedImages [4]*ebiten.Image
+	for n, img := range images {
+		if img == nil { continue }
+		if ebitenImage, isEbitenImage := img.(*ebiten.Image); isEbitenImage {
+			fixedImages[n] = ebitenImage
+		} else {
+			fixedImages[n] = ebiten.NewImageFromImage(img)
+			defer fixedImages[n].Dispose()
+		}
+	}
+	displayer := &shaderDisplayer{ scale: 1.0, fixedImages: &fixedImages }
+	displayer.setProgram(shader, program)
+	defer displayer.shader.Dispose()
+	defer func() {
+		for _, adapter := range displayer.imageAdapters {
+			if adapter != nil { adapter.Dispose() }
+		}
+	}()
+
+	// set up uniforms like shaderDisplayer.Draw()
+	canvas := image.Rect(0, 0, width, height)
+	values := make(map[string]any, len(uniforms) + 3)
+	values["Time"] = float32(0)
+	values["Cursor"] = []float32{0, 0}
+	values["MouseButtons"] = 0
+	if seconds, found := uniforms["Time"]; found {
+		// (built-in and auto uniforms need Time as a float32)
+		converted, err := convertUniform(seconds, "float")
+		if err != nil { return nil, &uniformError{ "Time", err } }
+		if _, isFloat := converted.(float32); !isFloat {
+			return nil, &uniformError{ "Time", fmt.Errorf("expected a single number, got %T", seconds) }
+		}
+		values["Time"] = converted
+	}
+	displayer.builtins.Set(values, displayer.declaredUniforms, canvas)
+	displayer.autoUniforms.Set(values)
+	for key, value := range uniforms {
+		values[key] = value
+	}
+	errs := convertUniforms(values, displayer.declaredUniforms)
+	if len(errs) > 0 { return nil, errs[0] }
+	displayer.options.Uniforms = values
+
+	// render and read back (without the background, so alpha is kept)
+	target := ebiten.NewImage(width, height)
+	defer target.Dispose()
+	displayer.drawShaderOutput(target, canvas)
+	rgba := image.NewRGBA(canvas)
+	target.ReadPixels(rgba.Pix)
+	return rgba, nil
+}
@@ -0,0 +1,236 @@
+package kagecpu
+
+import "math"
+import "strconv"
+import "go/ast"
+import "go/token"
+
+// Componentwise functions of one float argument.
+var builtinMaps = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+	"exp": math.Exp, "log": math.Log, "exp2": math.Exp2, "log2": math.Log2,
+	"sqrt": math.Sqrt, "floor": math.Floor, "ceil": math.Ceil,
+	"inversesqrt": func(x float64) float64 { return 1.0/math.Sqrt(x) },
+	"fract": func(x float64) float64 { return x - math.Floor(x) },
+}
+
+// Componentwise functions of two or three arguments, with scalar
+// arguments being broadcast to the size of the vector arguments.
+var builtinZips = map[string]func(x, y, z float64) float64{
+	"atan2": func(y, x, _ float64) float64 { return math.Atan2(y, x) },
+	"pow": func(x, y, _ float64) float64 { return math.Pow(x, y) },
+	"mod": func(x, y, _ float64) float64 { return x - y*math.Floor(x/y) },
+	"min": func(x, y, _ float64) float64 { return math.Min(x, y) },
+	"max": func(x, y, _ float64) float64 { return math.Max(x, y) },
+	"step": func(edge, x, _ float64) float64 {
+		if x < edge { return 0 }
+		return 1
+	},
+	"clamp": func(x, lo, hi float64) float64 { return math.Min(math.Max(x, lo), hi) },
+	"mix": func(a, b, t float64) float64 { return a*(1 - t) + b*t },
+	"smoothstep": func(e0, e1, x float64) float64 {
+		t := math.Min(math.Max((x - e0)/(e1 - e0), 0), 1)
+		return t*t*(3 - 2*t)
+	},
+}
+
+// Zips that keep integer types when all the arguments are integers.
+var builtinIntZips = map[string]bool{ "min": true, "max": true, "clamp": true }
+
+var builtinArities = map[string]int{
+	"atan2": 2, "pow": 2, "mod": 2, "min": 2, "max": 2, "step": 2,
+	"clamp": 3, "mix": 3, "smoothstep": 3,
+	"abs": 1, "sign": 1, "length": 1, "normalize": 1,
+	"distance": 2, "dot": 2, "cross": 2, "reflect": 2,
+	"faceforward": 3, "refract": 3,
+	"dFdx": 1, "dFdy": 1, "fwidth": 1, "discard": 0,
+	"imageDstOrigin": 0, "imageDstSize": 0,
+}
+
+func (self *compiler) builtin(expr *ast.CallExpr, name string, args []evalFn) evalFn {
+	arity, found := builtinArities[name]
+	if _, isMap := builtinMaps[name]; isMap { arity, found = 1, true }
+	n, method, isImage := parseImageBuiltin(name)
+	if isImage {
+		arity, found = 0, true
+		if method == "At" || method == "UnsafeAt" { arity = 1 }
+	}
+	if !found { self.failf(expr.Fun, "undefined: %s", name) }
+	if len(args) != arity {
+		self.failf(expr, "wrong number of arguments in call to %s(): have %d, want %d", name, len(args), arity)
+	}
+
+	if isImage { return imageBuiltin(n, method, args) }
+	fn, isMap := builtinMaps[name]
+	if isMap {
+		arg := args[0]
+		return func(fr frame) value { return mapFloat(arg(fr), fn) }
+	}
+	zip, isZip := builtinZips[name]
+	if isZip {
+		keepInts := builtinIntZips[name]
+		if arity == 2 {
+			x, y := args[0], args[1]
+			return func(fr frame) value {
+				yVal := y(fr) // (passed again as the unused third argument)
+				return zip3(x(fr), yVal, yVal, keepInts, zip)
+			}
+		}
+		x, y, z := args[0], args[1], args[2]
+		return func(fr frame) value { return zip3(x(fr), y(fr), z(fr), keepInts, zip) }
+	}
+
+	switch name {
+	case "abs":
+		arg := args[0]
+		return func(fr frame) value { return mapNumeric(arg(fr), math.Abs) }
+	case "sign":
+		arg := args[0]
+		return func(fr frame) value {
+			return mapNumeric(arg(fr), func(x float64) float64 {
+				if x > 0 { return 1 }
+				if x < 0 { return -1 }
+				return 0
+			})
+		}
+	case "length":
+		arg := args[0]
+		return func(fr frame) value { return floatValue(length(arg(fr))) }
+	case "distance":
+		a, b := args[0], args[1]
+		return func(fr frame) value { return floatValue(length(arith(token.SUB, a(fr), b(fr)))) }
+	case "dot":
+		a, b := args[0], args[1]
+		return func(fr frame) value { return floatValue(dot(a(fr), b(fr))) }
+	case "normalize":
+		arg := args[0]
+		return func(fr frame) value {
+			val := arg(fr)
+			return arith(token.QUO, val, floatValue(length(val)))
+		}
+	case "cross":
+		a, b := args[0], args[1]
+		return func(fr frame) value {
+			x, y := a(fr), b(fr)
+			if x.kind != kindVec3 || y.kind != kindVec3 { panic(runtimeErrorf("cross() requires vec3 arguments")) }
+			return value{ kind: kindVec3, v: [4]float64{
+				x.v[1]*y.v[2] - x.v[2]*y.v[1],
+				x.v[2]*y.v[0] - x.v[0]*y.v[2],
+				x.v[0]*y.v[1] - x.v[1]*y.v[0],
+			}}
+		}
+	case "reflect":
+		a, b := args[0], args[1]
+		return func(fr frame) value {
+			incident, normal := a(fr), b(fr)
+			scale := floatValue(2*dot(normal, incident))
+			return arith(token.SUB, incident, arith(token.MUL, scale, normal))
+		}
+	case "refract":
+		a, b, c := args[0], args[1], args[2]
+		return func(fr frame) value {
+			incident, normal, eta := a(fr), b(fr), c(fr).v[0]
+			d := dot(normal, incident)
+			k := 1.0 - eta*eta*(1.0 - d*d)
+			if k < 0 { return value{ kind: incident.kind } }
+			return arith(token.SUB,
+				arith(token.MUL, floatValue(eta), incident),
+				arith(token.MUL, floatValue(eta*d + math.Sqrt(k)), normal),
+			)
+		}
+	case "faceforward":
+		a, b, c := args[0], args[1], args[2]
+		return func(fr frame) value {
+			normal, incident, ref := a(fr), b(fr), c(fr)
+			if dot(ref, incident) < 0 { return normal }
+			return arith(token.MUL, floatValue(-1), normal)
+		}
+	case "dFdx", "dFdy", "fwidth":
+		self.usesDerivatives = true
+		arg := args[0]
+		return func(fr frame) value { return fr.ctx.derivative(name, arg(fr)) }
+	case "discard":
+		return func(frame) value { panic(errDiscard) }
+	case "imageDstOrigin":
+		return constEval(value{ kind: kindVec2 })
+	case "imageDstSize":
+		return func(fr frame) value {
+			return value{ kind: kindVec2, v: [4]float64{ fr.ctx.dstWidth, fr.ctx.dstHeight } }
+		}
+	default:
+		panic("unreachable")
+	}
+}
+
+// Parses names like imageSrc2At or imageSrc0Size.
+func parseImageBuiltin(name string) (int, string, bool) {
+	const prefix = "imageSrc"
+	if len(name) < len(prefix) + 2 || name[ : len(prefix)] != prefix { return 0, "", false }
+	n, err := strconv.Atoi(name[len(prefix) : len(prefix) + 1])
+	if err != nil || n > 3 { return 0, "", false }
+	method := name[len(prefix) + 1 : ]
+	switch method {
+	case "At", "UnsafeAt", "Size", "Origin":
+		return n, method, true
+	default:
+		return 0, "", false
+	}
+}
+
+func imageBuiltin(n int, method string, args []evalFn) evalFn {
+	switch method {
+	case "At", "UnsafeAt":
+		pos := args[0]
+		return func(fr frame) value { return fr.ctx.sample(n, pos(fr)) }
+	case "Size":
+		return func(fr frame) value { return fr.ctx.sourceSize(n) }
+	case "Origin":
+		return constEval(value{ kind: kindVec2 })
+	default:
+		panic("unreachable")
+	}
+}
+
+// Like mapFloat, but keeping integer types.
+func mapNumeric(val value, fn func(float64) float64) value {
+	if !val.kind.isNumeric() { panic(runtimeErrorf("invalid argument of type %s", val.kind)) }
+	for i := 0; i < val.kind.size(); i++ {
+		val.v[i] = fn(val.v[i])
+	}
+	return val
+}
+
+func zip3(x, y, z value, keepInts bool, fn func(x, y, z float64) float64) value {
+	if !x.kind.isNumeric() || !y.kind.isNumeric() || !z.kind.isNumeric() {
+		panic(runtimeErrorf("invalid arguments of types %s, %s and %s", x.kind, y.kind, z.kind))
+	}
+	size := broadcastSize(broadcastValue(x, y), z)
+	isInt := keepInts && x.kind.isInt() && y.kind.isInt() && z.kind.isInt()
+	out := value{ kind: vecKind(size, isInt) }
+	for i := 0; i < size; i++ {
+		out.v[i] = fn(x.at(i), y.at(i), z.at(i))
+	}
+	return out
+}
+
+// Returns a value with the broadcast size of a and b, only
+// meant to be used with broadcastSize().
+func broadcastValue(a, b value) value {
+	return value{ kind: vecKind(broadcastSize(a, b), false) }
+}
+
+func dot(a, b value) float64 {
+	if !a.kind.isNumeric() || a.kind.size() != b.kind.size() {
+		panic(runtimeErrorf("mismatched types %s and %s", a.kind, b.kind))
+	}
+	var sum float64
+	for i := 0; i < a.kind.size(); i++ {
+		sum += a.v[i]*b.v[i]
+	}
+	return sum
+}
+
+func length(val value) float64 {
+	return math.Sqrt(dot(val, val))
+}
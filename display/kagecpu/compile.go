@@ -0,0 +1,876 @@
+package kagecpu
+
+import "fmt"
+import "strings"
+import "strconv"
+import "go/ast"
+import "go/token"
+
+// Programs are compiled to trees of closures that operate on frames.
+// Values are dynamically typed: most type errors are only detected
+// while running the program.
+
+type evalFn func(frame) value
+type execFn func(frame) control
+type setFn  func(frame, value)
+
+type control uint8
+const (
+	controlNone control = iota
+	controlBreak
+	controlContinue
+	controlReturn
+)
+
+// Limits to fail on runaway programs instead of hanging.
+const maxLoopIterations = 1 << 20
+const maxCallDepth = 64
+
+// Functions can't return more values than this.
+const maxResults = 8
+
+// A function call frame. Local variables are stored on the
+// context stack, starting at base.
+type frame struct {
+	ctx *execContext
+	base int
+}
+
+type function struct {
+	name string
+	decl *ast.FuncDecl
+	paramKinds []kind
+	paramSlots []int
+	resultKinds []kind
+	resultSlots []int // only for named results
+	numSlots int
+	body execFn
+}
+
+// Calls the function. Results are left in the context returns.
+func (self *function) call(caller frame, args []evalFn) {
+	ctx := caller.ctx
+	ctx.depth += 1
+	if ctx.depth > maxCallDepth { panic(runtimeErrorf("max call depth exceeded on %s()", self.name)) }
+	base := len(ctx.stack)
+	for i := 0; i < self.numSlots; i++ {
+		ctx.stack = append(ctx.stack, value{})
+	}
+	callee := frame{ ctx: ctx, base: base }
+	for i, arg := range args {
+		val := convertTo(arg(caller), self.paramKinds[i])
+		ctx.stack[base + self.paramSlots[i]] = val
+	}
+	for i, slot := range self.resultSlots {
+		ctx.stack[base + slot] = value{ kind: self.resultKinds[i] }
+	}
+
+	if self.body(callee) != controlReturn {
+		self.setBareReturns(callee)
+	}
+	ctx.stack = ctx.stack[ : base]
+	ctx.depth -= 1
+}
+
+// Sets the context returns to the named results, or zero values.
+func (self *function) setBareReturns(fr frame) {
+	fr.ctx.returns = fr.ctx.returns[ : 0]
+	for i, resultKind := range self.resultKinds {
+		val := value{ kind: resultKind }
+		if self.resultSlots != nil { val = fr.ctx.stack[fr.base + self.resultSlots[i]] }
+		fr.ctx.returns = append(fr.ctx.returns, val)
+	}
+}
+
+type binding struct {
+	slot int
+	constant *value
+}
+
+type compileError struct {
+	pos token.Pos
+	msg string
+}
+
+type compiler struct {
+	consts map[string]value
+	uniforms map[string]int
+	uniformKinds []kind
+	funcs map[string]*function
+
+	// current function state
+	fn *function
+	scopes []map[string]binding
+	numSlots int
+
+	usesDerivatives bool
+}
+
+func (self *compiler) failf(node ast.Node, format string, args ...any) {
+	panic(compileError{ pos: node.Pos(), msg: fmt.Sprintf(format, args...) })
+}
+
+func (self *compiler) pushScope() {
+	self.scopes = append(self.scopes, make(map[string]binding))
+}
+
+func (self *compiler) popScope() {
+	self.scopes = self.scopes[ : len(self.scopes) - 1]
+}
+
+// Declares a new local variable in the innermost scope and returns its slot.
+func (self *compiler) declare(name string) int {
+	slot := self.numSlots
+	self.numSlots += 1
+	if name != "_" {
+		self.scopes[len(self.scopes) - 1][name] = binding{ slot: slot }
+	}
+	return slot
+}
+
+func (self *compiler) lookup(name string) (binding, bool) {
+	for i := len(self.scopes) - 1; i >= 0; i-- {
+		b, found := self.scopes[i][name]
+		if found { return b, true }
+	}
+	return binding{}, false
+}
+
+func (self *compiler) typeKind(expr ast.Expr) kind {
+	ident, isIdent := expr.(*ast.Ident)
+	if isIdent {
+		k, found := kindNames[ident.Name]
+		if found { return k }
+	}
+	self.failf(expr, "unsupported type %s", exprString(expr))
+	panic("unreachable")
+}
+
+// --- declarations ---
+
+func (self *compiler) declareUniforms(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Type == nil || len(spec.Values) > 0 {
+			self.failf(spec, "uniform variables can't be initialized")
+		}
+		uniformKind := self.typeKind(spec.Type)
+		for _, name := range spec.Names {
+			if self.isDeclared(name.Name) { self.failf(name, "%s redeclared", name.Name) }
+			self.uniforms[name.Name] = len(self.uniformKinds)
+			self.uniformKinds = append(self.uniformKinds, uniformKind)
+		}
+	}
+}
+
+func (self *compiler) isDeclared(name string) bool {
+	_, isConst := self.consts[name]
+	_, isUniform := self.uniforms[name]
+	_, isFunc := self.funcs[name]
+	return isConst || isUniform || isFunc
+}
+
+// Evaluates a const declaration, calling define for each constant.
+func (self *compiler) declareConsts(decl *ast.GenDecl, define func(*ast.Ident, value)) {
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if len(spec.Values) != len(spec.Names) {
+			self.failf(spec, "constants must be explicitly initialized")
+		}
+		for i, name := range spec.Names {
+			val := self.evalConst(spec.Values[i])
+			if spec.Type != nil { val = self.checkedConvert(spec.Values[i], val, self.typeKind(spec.Type)) }
+			define(name, val)
+		}
+	}
+}
+
+func (self *compiler) evalConst(expr ast.Expr) (val value) {
+	eval := self.expr(expr)
+	defer func() {
+		if recover() != nil { self.failf(expr, "%s is not constant", exprString(expr)) }
+	}()
+	return eval(frame{ ctx: &execContext{} })
+}
+
+func (self *compiler) checkedConvert(node ast.Node, val value, target kind) value {
+	defer func() {
+		err := recover()
+		if err != nil { self.failf(node, "%s", err) }
+	}()
+	return convertTo(val, target)
+}
+
+// Registers the function signature, so it can be called before
+// its body is compiled.
+func (self *compiler) declareFunc(decl *ast.FuncDecl) {
+	if decl.Recv != nil { self.failf(decl, "methods are not supported") }
+	if decl.Body == nil { self.failf(decl, "missing function body") }
+	if self.isDeclared(decl.Name.Name) { self.failf(decl.Name, "%s redeclared", decl.Name.Name) }
+	fn := &function{ name: decl.Name.Name, decl: decl }
+	for _, field := range decl.Type.Params.List {
+		paramKind := self.typeKind(field.Type)
+		for i := 0; i < maxInt(1, len(field.Names)); i++ {
+			fn.paramKinds = append(fn.paramKinds, paramKind)
+		}
+	}
+	if decl.Type.Results != nil {
+		for _, field := range decl.Type.Results.List {
+			resultKind := self.typeKind(field.Type)
+			for i := 0; i < maxInt(1, len(field.Names)); i++ {
+				fn.resultKinds = append(fn.resultKinds, resultKind)
+			}
+		}
+	}
+	if len(fn.resultKinds) > maxResults {
+		self.failf(decl.Type.Results, "functions can't return more than %d values", maxResults)
+	}
+	self.funcs[fn.name] = fn
+}
+
+func (self *compiler) compileFunc(fn *function) {
+	self.fn = fn
+	self.scopes = nil
+	self.numSlots = 0
+	self.pushScope()
+	for _, field := range fn.decl.Type.Params.List {
+		if len(field.Names) == 0 {
+			fn.paramSlots = append(fn.paramSlots, self.declare("_"))
+		}
+		for _, name := range field.Names {
+			fn.paramSlots = append(fn.paramSlots, self.declare(name.Name))
+		}
+	}
+	if fn.decl.Type.Results != nil {
+		for _, field := range fn.decl.Type.Results.List {
+			for _, name := range field.Names {
+				fn.resultSlots = append(fn.resultSlots, self.declare(name.Name))
+			}
+		}
+	}
+	fn.body = self.block(fn.decl.Body.List)
+	self.popScope()
+	fn.numSlots = self.numSlots
+	self.fn = nil
+}
+
+// --- statements ---
+
+func (self *compiler) block(stmts []ast.Stmt) execFn {
+	self.pushScope()
+	defer self.popScope()
+
+	execs := make([]execFn, 0, len(stmts))
+	for _, stmt := range stmts {
+		exec := self.stmt(stmt)
+		if exec != nil { execs = append(execs, exec) }
+	}
+	return func(fr frame) control {
+		for _, exec := range execs {
+			ctrl := exec(fr)
+			if ctrl != controlNone { return ctrl }
+		}
+		return controlNone
+	}
+}
+
+func (self *compiler) stmt(stmt ast.Stmt) execFn {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		return self.block(stmt.List)
+	case *ast.EmptyStmt:
+		return nil
+	case *ast.ExprStmt:
+		_, isCall := stmt.X.(*ast.CallExpr)
+		if !isCall { self.failf(stmt, "%s is not used", exprString(stmt.X)) }
+		eval := self.expr(stmt.X)
+		return func(fr frame) control {
+			eval(fr)
+			return controlNone
+		}
+	case *ast.AssignStmt:
+		return self.assign(stmt)
+	case *ast.IncDecStmt:
+		op := token.ADD
+		if stmt.Tok == token.DEC { op = token.SUB }
+		get, set := self.expr(stmt.X), self.lvalue(stmt.X)
+		one := value{ kind: kindInt, untyped: true, v: [4]float64{1} }
+		return func(fr frame) control {
+			set(fr, arith(op, get(fr), one))
+			return controlNone
+		}
+	case *ast.DeclStmt:
+		return self.declStmt(stmt.Decl.(*ast.GenDecl))
+	case *ast.IfStmt:
+		return self.ifStmt(stmt)
+	case *ast.ForStmt:
+		return self.forStmt(stmt)
+	case *ast.BranchStmt:
+		if stmt.Label != nil { self.failf(stmt, "labels are not supported") }
+		switch stmt.Tok {
+		case token.BREAK: return func(frame) control { return controlBreak }
+		case token.CONTINUE: return func(frame) control { return controlContinue }
+		default:
+			self.failf(stmt, "%s is not supported", stmt.Tok)
+		}
+	case *ast.ReturnStmt:
+		return self.returnStmt(stmt)
+	default:
+		self.failf(stmt, "unsupported statement %T", stmt)
+	}
+	panic("unreachable")
+}
+
+func (self *compiler) declStmt(decl *ast.GenDecl) execFn {
+	switch decl.Tok {
+	case token.CONST:
+		self.declareConsts(decl, func(name *ast.Ident, val value) {
+			if name.Name == "_" { return }
+			self.scopes[len(self.scopes) - 1][name.Name] = binding{ constant: &val }
+		})
+		return nil
+	case token.VAR:
+		var execs []execFn
+		for _, spec := range decl.Specs {
+			execs = append(execs, self.varSpec(spec.(*ast.ValueSpec)))
+		}
+		return func(fr frame) control {
+			for _, exec := range execs { exec(fr) }
+			return controlNone
+		}
+	default:
+		self.failf(decl, "%s declarations are not supported", decl.Tok)
+		panic("unreachable")
+	}
+}
+
+func (self *compiler) varSpec(spec *ast.ValueSpec) execFn {
+	varKind := kindVoid
+	if spec.Type != nil { varKind = self.typeKind(spec.Type) }
+	if len(spec.Values) != 0 && len(spec.Values) != len(spec.Names) {
+		self.failf(spec, "assignment mismatch: %d variables but %d values", len(spec.Names), len(spec.Values))
+	}
+	values := make([]evalFn, len(spec.Values))
+	for i, expr := range spec.Values {
+		values[i] = self.expr(expr)
+	}
+	slots := make([]int, len(spec.Names))
+	for i, name := range spec.Names {
+		slots[i] = self.declare(name.Name)
+	}
+
+	// (values are compiled before declaring the new variables, so
+	// they can't refer to them and can be assigned in order)
+	return func(fr frame) control {
+		for i, slot := range slots {
+			val := value{ kind: varKind }
+			if len(values) > 0 {
+				val = values[i](fr)
+				if varKind != kindVoid { val = convertTo(val, varKind) }
+			}
+			defineSlot(fr, slot, val)
+		}
+		return controlNone
+	}
+}
+
+func (self *compiler) assign(stmt *ast.AssignStmt) execFn {
+	if stmt.Tok != token.DEFINE && stmt.Tok != token.ASSIGN {
+		return self.opAssign(stmt)
+	}
+
+	if len(stmt.Lhs) > maxResults { self.failf(stmt, "too many assignments in a single statement") }
+	if len(stmt.Rhs) == 1 && len(stmt.Lhs) > 1 {
+		return self.multiAssign(stmt)
+	}
+	if len(stmt.Lhs) != len(stmt.Rhs) {
+		self.failf(stmt, "assignment mismatch: %d variables but %d values", len(stmt.Lhs), len(stmt.Rhs))
+	}
+
+	values := make([]evalFn, len(stmt.Rhs))
+	for i, expr := range stmt.Rhs {
+		values[i] = self.expr(expr)
+	}
+	setters := self.assignTargets(stmt)
+	if len(setters) == 1 {
+		set, eval := setters[0], values[0]
+		return func(fr frame) control {
+			set(fr, eval(fr))
+			return controlNone
+		}
+	}
+	return func(fr frame) control {
+		var buffer [maxResults]value
+		for i, eval := range values { buffer[i] = eval(fr) }
+		for i, set := range setters { set(fr, buffer[i]) }
+		return controlNone
+	}
+}
+
+// Assignments like 'a, b := fn()'.
+func (self *compiler) multiAssign(stmt *ast.AssignStmt) execFn {
+	call, isCall := stmt.Rhs[0].(*ast.CallExpr)
+	var fn *function
+	if isCall {
+		ident, isIdent := call.Fun.(*ast.Ident)
+		if isIdent { fn = self.funcs[ident.Name] }
+	}
+	if fn == nil { self.failf(stmt, "assignment mismatch: %d variables but 1 value", len(stmt.Lhs)) }
+	if len(fn.resultKinds) != len(stmt.Lhs) {
+		self.failf(stmt, "assignment mismatch: %d variables but %s() returns %d values", len(stmt.Lhs), fn.name, len(fn.resultKinds))
+	}
+
+	args := self.callArgs(call, fn)
+	setters := self.assignTargets(stmt)
+	return func(fr frame) control {
+		fn.call(fr, args)
+		var buffer [maxResults]value
+		copy(buffer[ : ], fr.ctx.returns)
+		for i, set := range setters { set(fr, buffer[i]) }
+		return controlNone
+	}
+}
+
+// Returns the setters for the left side of an assignment. For
+// definitions, new variables are declared.
+func (self *compiler) assignTargets(stmt *ast.AssignStmt) []setFn {
+	setters := make([]setFn, len(stmt.Lhs))
+	if stmt.Tok == token.ASSIGN {
+		for i, expr := range stmt.Lhs {
+			setters[i] = self.lvalue(expr)
+		}
+		return setters
+	}
+
+	newVars := 0
+	scope := self.scopes[len(self.scopes) - 1]
+	for i, expr := range stmt.Lhs {
+		ident, isIdent := expr.(*ast.Ident)
+		if !isIdent { self.failf(expr, "non-name %s on left side of :=", exprString(expr)) }
+		b, found := scope[ident.Name]
+		if found && b.constant == nil {
+			setters[i] = self.lvalue(ident)
+			continue
+		}
+		if ident.Name != "_" { newVars += 1 }
+		slot := self.declare(ident.Name)
+		setters[i] = func(fr frame, val value) { defineSlot(fr, slot, val) }
+	}
+	if newVars == 0 { self.failf(stmt, "no new variables on left side of :=") }
+	return setters
+}
+
+var opAssignTokens = map[token.Token]token.Token{
+	token.ADD_ASSIGN: token.ADD, token.SUB_ASSIGN: token.SUB,
+	token.MUL_ASSIGN: token.MUL, token.QUO_ASSIGN: token.QUO,
+	token.REM_ASSIGN: token.REM, token.AND_ASSIGN: token.AND,
+	token.OR_ASSIGN : token.OR , token.XOR_ASSIGN: token.XOR,
+	token.SHL_ASSIGN: token.SHL, token.SHR_ASSIGN: token.SHR,
+	token.AND_NOT_ASSIGN: token.AND_NOT,
+}
+
+// Assignments like 'x += y'.
+func (self *compiler) opAssign(stmt *ast.AssignStmt) execFn {
+	op, found := opAssignTokens[stmt.Tok]
+	if !found { self.failf(stmt, "unsupported assignment %s", stmt.Tok) }
+	if len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+		self.failf(stmt, "assignment operation %s requires single-valued expressions", stmt.Tok)
+	}
+	get, set := self.expr(stmt.Lhs[0]), self.lvalue(stmt.Lhs[0])
+	eval := self.expr(stmt.Rhs[0])
+	return func(fr frame) control {
+		rhs := eval(fr)
+		set(fr, arith(op, get(fr), rhs))
+		return controlNone
+	}
+}
+
+func (self *compiler) lvalue(expr ast.Expr) setFn {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return self.lvalue(expr.X)
+	case *ast.Ident:
+		if expr.Name == "_" { return func(frame, value) {} }
+		b, found := self.lookup(expr.Name)
+		if !found {
+			_, isUniform := self.uniforms[expr.Name]
+			if isUniform { self.failf(expr, "cannot assign to uniform %s", expr.Name) }
+			_, isConst := self.consts[expr.Name]
+			if isConst { self.failf(expr, "cannot assign to constant %s", expr.Name) }
+			self.failf(expr, "undefined: %s", expr.Name)
+		}
+		if b.constant != nil { self.failf(expr, "cannot assign to constant %s", expr.Name) }
+		slot := b.slot
+		return func(fr frame, val value) { assignSlot(fr, slot, val) }
+	case *ast.SelectorExpr:
+		indices := self.swizzleIndices(expr)
+		for i := 0; i < len(indices); i++ {
+			for j := i + 1; j < len(indices); j++ {
+				if indices[i] == indices[j] { self.failf(expr.Sel, "cannot assign to swizzle with repeated components") }
+			}
+		}
+		get, set := self.expr(expr.X), self.lvalue(expr.X)
+		return func(fr frame, val value) {
+			base := get(fr)
+			if base.kind.size() < 2 { panic(runtimeErrorf("can't swizzle %s value", base.kind)) }
+			val = convertTo(val, vecKind(len(indices), base.kind.isInt()))
+			for i, index := range indices {
+				if index >= base.kind.size() { panic(runtimeErrorf("swizzle out of range for %s", base.kind)) }
+				base.v[index] = val.v[i]
+			}
+			set(fr, base)
+		}
+	case *ast.IndexExpr:
+		get, set, index := self.expr(expr.X), self.lvalue(expr.X), self.expr(expr.Index)
+		return func(fr frame, val value) {
+			base := get(fr)
+			i := checkIndex(base, index(fr))
+			base.v[i] = convertTo(val, vecKind(1, base.kind.isInt())).v[0]
+			set(fr, base)
+		}
+	default:
+		self.failf(expr, "cannot assign to %s", exprString(expr))
+		panic("unreachable")
+	}
+}
+
+func assignSlot(fr frame, slot int, val value) {
+	target := &fr.ctx.stack[fr.base + slot]
+	if target.kind != kindVoid {
+		val = convertTo(val, target.kind)
+	} else {
+		val.untyped = false
+	}
+	*target = val
+}
+
+func defineSlot(fr frame, slot int, val value) {
+	val.untyped = false
+	fr.ctx.stack[fr.base + slot] = val
+}
+
+func (self *compiler) ifStmt(stmt *ast.IfStmt) execFn {
+	self.pushScope()
+	defer self.popScope()
+
+	var init, otherwise execFn
+	if stmt.Init != nil { init = self.stmt(stmt.Init) }
+	cond := self.expr(stmt.Cond)
+	body := self.block(stmt.Body.List)
+	if stmt.Else != nil { otherwise = self.stmt(stmt.Else) }
+	return func(fr frame) control {
+		if init != nil { init(fr) }
+		if checkBool(cond(fr)) { return body(fr) }
+		if otherwise != nil { return otherwise(fr) }
+		return controlNone
+	}
+}
+
+func (self *compiler) forStmt(stmt *ast.ForStmt) execFn {
+	self.pushScope()
+	defer self.popScope()
+
+	var init, post execFn
+	var cond evalFn
+	if stmt.Init != nil { init = self.stmt(stmt.Init) }
+	if stmt.Cond != nil { cond = self.expr(stmt.Cond) }
+	if stmt.Post != nil { post = self.stmt(stmt.Post) }
+	body := self.block(stmt.Body.List)
+	return func(fr frame) control {
+		if init != nil { init(fr) }
+		for i := 0; cond == nil || checkBool(cond(fr)); i++ {
+			if i >= maxLoopIterations { panic(runtimeErrorf("loop exceeded %d iterations", maxLoopIterations)) }
+			switch body(fr) {
+			case controlBreak: return controlNone
+			case controlReturn: return controlReturn
+			}
+			if post != nil { post(fr) }
+		}
+		return controlNone
+	}
+}
+
+func (self *compiler) returnStmt(stmt *ast.ReturnStmt) execFn {
+	fn := self.fn
+	if len(stmt.Results) == 0 {
+		return func(fr frame) control {
+			fn.setBareReturns(fr)
+			return controlReturn
+		}
+	}
+
+	// return of a multi-valued call
+	if len(stmt.Results) == 1 && len(fn.resultKinds) > 1 {
+		call, isCall := stmt.Results[0].(*ast.CallExpr)
+		var callee *function
+		if isCall {
+			ident, isIdent := call.Fun.(*ast.Ident)
+			if isIdent { callee = self.funcs[ident.Name] }
+		}
+		if callee == nil || len(callee.resultKinds) != len(fn.resultKinds) {
+			self.failf(stmt, "wrong number of return values for %s()", fn.name)
+		}
+		args := self.callArgs(call, callee)
+		return func(fr frame) control {
+			callee.call(fr, args)
+			for i, val := range fr.ctx.returns {
+				fr.ctx.returns[i] = convertTo(val, fn.resultKinds[i])
+			}
+			return controlReturn
+		}
+	}
+
+	if len(stmt.Results) != len(fn.resultKinds) {
+		self.failf(stmt, "wrong number of return values for %s()", fn.name)
+	}
+	results := make([]evalFn, len(stmt.Results))
+	for i, expr := range stmt.Results {
+		results[i] = self.expr(expr)
+	}
+	return func(fr frame) control {
+		var buffer [maxResults]value
+		for i, eval := range results {
+			buffer[i] = convertTo(eval(fr), fn.resultKinds[i])
+		}
+		fr.ctx.returns = append(fr.ctx.returns[ : 0], buffer[ : len(results)]...)
+		return controlReturn
+	}
+}
+
+// --- expressions ---
+
+func constEval(val value) evalFn {
+	return func(frame) value { return val }
+}
+
+func (self *compiler) expr(expr ast.Expr) evalFn {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return constEval(self.literal(expr))
+	case *ast.Ident:
+		return self.ident(expr)
+	case *ast.ParenExpr:
+		return self.expr(expr.X)
+	case *ast.UnaryExpr:
+		return self.unary(expr)
+	case *ast.BinaryExpr:
+		return self.binary(expr)
+	case *ast.CallExpr:
+		return self.call(expr)
+	case *ast.SelectorExpr:
+		indices := self.swizzleIndices(expr)
+		eval := self.expr(expr.X)
+		return func(fr frame) value { return swizzle(eval(fr), indices) }
+	case *ast.IndexExpr:
+		eval, index := self.expr(expr.X), self.expr(expr.Index)
+		return func(fr frame) value {
+			base := eval(fr)
+			i := checkIndex(base, index(fr))
+			return value{ kind: vecKind(1, base.kind.isInt()), v: [4]float64{ base.v[i] } }
+		}
+	default:
+		self.failf(expr, "unsupported expression %s", exprString(expr))
+		panic("unreachable")
+	}
+}
+
+func (self *compiler) literal(lit *ast.BasicLit) value {
+	text := strings.ReplaceAll(lit.Value, "_", "")
+	switch lit.Kind {
+	case token.INT:
+		n, err := strconv.ParseInt(text, 0, 64)
+		if err != nil { self.failf(lit, "invalid integer literal %s", lit.Value) }
+		return value{ kind: kindInt, untyped: true, v: [4]float64{ float64(n) } }
+	case token.FLOAT:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil { self.failf(lit, "invalid float literal %s", lit.Value) }
+		return floatValue(f)
+	default:
+		self.failf(lit, "unsupported literal %s", lit.Value)
+		panic("unreachable")
+	}
+}
+
+func (self *compiler) ident(ident *ast.Ident) evalFn {
+	b, found := self.lookup(ident.Name)
+	if found {
+		if b.constant != nil { return constEval(*b.constant) }
+		slot := b.slot
+		return func(fr frame) value { return fr.ctx.stack[fr.base + slot] }
+	}
+	val, isConst := self.consts[ident.Name]
+	if isConst { return constEval(val) }
+	index, isUniform := self.uniforms[ident.Name]
+	if isUniform {
+		return func(fr frame) value { return fr.ctx.uniforms[index] }
+	}
+	switch ident.Name {
+	case "true" : return constEval(boolValue(true))
+	case "false": return constEval(boolValue(false))
+	}
+	self.failf(ident, "undefined: %s", ident.Name)
+	panic("unreachable")
+}
+
+func (self *compiler) unary(expr *ast.UnaryExpr) evalFn {
+	eval := self.expr(expr.X)
+	switch expr.Op {
+	case token.ADD:
+		return eval
+	case token.SUB:
+		return func(fr frame) value {
+			val := eval(fr)
+			if !val.kind.isNumeric() { panic(runtimeErrorf("invalid operation -%s", val.kind)) }
+			for i := 0; i < val.kind.size(); i++ { val.v[i] = -val.v[i] }
+			return val
+		}
+	case token.NOT:
+		return func(fr frame) value { return boolValue(!checkBool(eval(fr))) }
+	case token.XOR:
+		return func(fr frame) value {
+			val := eval(fr)
+			if !val.kind.isInt() { panic(runtimeErrorf("invalid operation ^%s", val.kind)) }
+			for i := 0; i < val.kind.size(); i++ { val.v[i] = float64(^int64(val.v[i])) }
+			return val
+		}
+	default:
+		self.failf(expr, "unsupported operator %s", expr.Op)
+		panic("unreachable")
+	}
+}
+
+func (self *compiler) binary(expr *ast.BinaryExpr) evalFn {
+	x, y := self.expr(expr.X), self.expr(expr.Y)
+	op := expr.Op
+	switch op {
+	case token.LAND:
+		return func(fr frame) value { return boolValue(checkBool(x(fr)) && checkBool(y(fr))) }
+	case token.LOR:
+		return func(fr frame) value { return boolValue(checkBool(x(fr)) || checkBool(y(fr))) }
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return func(fr frame) value { return compare(op, x(fr), y(fr)) }
+	default:
+		return func(fr frame) value { return arith(op, x(fr), y(fr)) }
+	}
+}
+
+func (self *compiler) call(expr *ast.CallExpr) evalFn {
+	ident, isIdent := expr.Fun.(*ast.Ident)
+	if !isIdent { self.failf(expr, "unsupported call to %s", exprString(expr.Fun)) }
+	if expr.Ellipsis.IsValid() { self.failf(expr, "variadic calls are not supported") }
+
+	name := ident.Name
+	fn, isFunc := self.funcs[name]
+	if isFunc {
+		if len(fn.resultKinds) > 1 {
+			self.failf(expr, "multiple-value %s() in single-value context", name)
+		}
+		args := self.callArgs(expr, fn)
+		return func(fr frame) value {
+			fn.call(fr, args)
+			if len(fr.ctx.returns) == 0 { return value{} }
+			return fr.ctx.returns[0]
+		}
+	}
+
+	args := make([]evalFn, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = self.expr(arg)
+	}
+	targetKind, isType := kindNames[name]
+	if isType { return self.conversion(expr, targetKind, args) }
+	return self.builtin(expr, name, args)
+}
+
+func (self *compiler) callArgs(expr *ast.CallExpr, fn *function) []evalFn {
+	if len(expr.Args) != len(fn.paramKinds) {
+		self.failf(expr, "wrong number of arguments in call to %s(): have %d, want %d", fn.name, len(expr.Args), len(fn.paramKinds))
+	}
+	args := make([]evalFn, len(expr.Args))
+	for i, arg := range expr.Args {
+		args[i] = self.expr(arg)
+	}
+	return args
+}
+
+// Conversions like float(x) and constructors like vec4(rgb, 1).
+func (self *compiler) conversion(expr *ast.CallExpr, target kind, args []evalFn) evalFn {
+	if len(args) == 0 { self.failf(expr, "missing argument in conversion to %s", target) }
+	if target.size() == 1 {
+		if len(args) != 1 { self.failf(expr, "too many arguments in conversion to %s", target) }
+		arg := args[0]
+		return func(fr frame) value { return castTo(arg(fr), target) }
+	}
+	if len(args) > target.size() { self.failf(expr, "too many arguments for %s", target) }
+	return func(fr frame) value {
+		var buffer [4]value
+		for i, arg := range args { buffer[i] = arg(fr) }
+		return construct(target, buffer[ : len(args)])
+	}
+}
+
+func construct(target kind, args []value) value {
+	size := target.size()
+	out := value{ kind: target }
+	if len(args) == 1 && args[0].kind.size() == 1 {
+		if args[0].kind == kindBool { panic(runtimeErrorf("cannot use bool in %s", target)) }
+		for i := 0; i < size; i++ { out.v[i] = args[0].v[0] }
+	} else {
+		n := 0
+		for _, arg := range args {
+			if !arg.kind.isNumeric() { panic(runtimeErrorf("cannot use %s in %s", arg.kind, target)) }
+			for i := 0; i < arg.kind.size(); i++ {
+				if n >= size { panic(runtimeErrorf("too many components for %s", target)) }
+				out.v[n] = arg.v[i]
+				n += 1
+			}
+		}
+		if n != size { panic(runtimeErrorf("not enough components for %s", target)) }
+	}
+	if target.isInt() {
+		for i := 0; i < size; i++ { out.v[i] = float64(int64(out.v[i])) }
+	}
+	return out
+}
+
+func (self *compiler) swizzleIndices(expr *ast.SelectorExpr) []int {
+	indices, valid := swizzleIndices(expr.Sel.Name)
+	if !valid { self.failf(expr.Sel, "invalid swizzle .%s", expr.Sel.Name) }
+	return indices
+}
+
+func checkIndex(base, index value) int {
+	if !index.kind.isInt() || index.kind.size() != 1 {
+		panic(runtimeErrorf("invalid index of type %s", index.kind))
+	}
+	i := int(index.v[0])
+	if base.kind.size() < 2 { panic(runtimeErrorf("cannot index %s value", base.kind)) }
+	if i < 0 || i >= base.kind.size() { panic(runtimeErrorf("index %d out of range for %s", i, base.kind)) }
+	return i
+}
+
+func checkBool(val value) bool {
+	if val.kind != kindBool { panic(runtimeErrorf("non-boolean condition of type %s", val.kind)) }
+	return val.isTrue()
+}
+
+func exprString(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident: return expr.Name
+	case *ast.BasicLit: return expr.Value
+	case *ast.ParenExpr: return "(" + exprString(expr.X) + ")"
+	case *ast.SelectorExpr: return exprString(expr.X) + "." + expr.Sel.Name
+	case *ast.IndexExpr: return exprString(expr.X) + "[" + exprString(expr.Index) + "]"
+	case *ast.CallExpr: return exprString(expr.Fun) + "(...)"
+	case *ast.UnaryExpr: return expr.Op.String() + exprString(expr.X)
+	case *ast.BinaryExpr: return exprString(expr.X) + " " + expr.Op.String() + " " + exprString(expr.Y)
+	case *ast.ArrayType: return "[...]" + exprString(expr.Elt)
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
+
+func maxInt(a, b int) int {
+	if a >= b { return a }
+	return b
+}
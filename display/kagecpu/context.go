@@ -0,0 +1,147 @@
+package kagecpu
+
+import "fmt"
+import "math"
+import "image"
+import "errors"
+import "go/token"
+
+var errDiscard = errors.New("discard")
+
+type runtimeError struct {
+	msg string
+}
+
+func runtimeErrorf(format string, args ...any) runtimeError {
+	return runtimeError{ fmt.Sprintf(format, args...) }
+}
+
+func (self runtimeError) Error() string {
+	return "kagecpu: " + self.msg
+}
+
+// Converts a recovered runtime error into an error, and resets the
+// context so it can be reused. Other panics are propagated.
+func recoverRuntimeError(r any, ctx *execContext) error {
+	if r == nil { return nil }
+	err, isRuntimeErr := r.(runtimeError)
+	if !isRuntimeErr { panic(r) }
+	ctx.stack, ctx.depth = ctx.stack[ : 0], 0
+	return err
+}
+
+type derivMode uint8
+const (
+	derivNone derivMode = iota // derivatives are zero
+	derivRecord // derivative arguments are recorded for the current lane
+	derivApply  // derivatives are computed from the recorded arguments
+)
+
+// State for running a program. Each goroutine needs its own context.
+type execContext struct {
+	stack []value
+	returns []value
+	depth int
+
+	uniforms []value
+	images [4]*sourceImage
+	unitPixels bool
+	dstWidth, dstHeight float64
+	srcWidth, srcHeight float64
+
+	// Derivatives are computed over 2x2 quads. Lanes are numbered
+	// 0 (top-left), 1 (top-right), 2 (bottom-left) and 3 (bottom-right).
+	derivMode derivMode
+	lane int
+	derivIndex int // index of the next derivative call on the current lane
+	quad [4][]value
+}
+
+func (self *execContext) derivative(name string, arg value) value {
+	zero := value{ kind: vecKind(arg.kind.size(), false) }
+	switch self.derivMode {
+	case derivNone:
+		return zero
+	case derivRecord:
+		self.quad[self.lane] = append(self.quad[self.lane], arg)
+		return zero
+	}
+
+	index := self.derivIndex
+	self.derivIndex += 1
+	dx, dy := self.quadDiff(index, 1, zero), self.quadDiff(index, 2, zero)
+	switch name {
+	case "dFdx": return dx
+	case "dFdy": return dy // (y grows downwards, like the destination coordinates)
+	case "fwidth":
+		return arith(token.ADD, mapNumeric(dx, math.Abs), mapNumeric(dy, math.Abs))
+	default:
+		panic("unreachable")
+	}
+}
+
+// Returns the difference between the recorded values for the given
+// derivative index in the current quad row (bit 1) or column (bit 2).
+func (self *execContext) quadDiff(index int, bit int, zero value) value {
+	first, second := self.quad[self.lane &^ bit], self.quad[self.lane | bit]
+	if index >= len(first) || index >= len(second) { return zero } // divergent control flow
+	return mapFloat(arith(token.SUB, second[index], first[index]), func(x float64) float64 { return x })
+}
+
+// Samples the source image n at the given position with nearest
+// filtering. Positions outside the image return transparent.
+func (self *execContext) sample(n int, pos value) value {
+	if pos.kind != kindVec2 { panic(runtimeErrorf("image position must be vec2, not %s", pos.kind)) }
+	source := self.images[n]
+	if source == nil { return value{ kind: kindVec4 } }
+	x, y := pos.v[0], pos.v[1]
+	if !self.unitPixels {
+		x *= float64(source.width)
+		y *= float64(source.height)
+	}
+	ix, iy := int(math.Floor(x)), int(math.Floor(y))
+	if x < 0 || y < 0 || ix >= source.width || iy >= source.height {
+		return value{ kind: kindVec4 }
+	}
+	offset := (iy*source.width + ix)*4
+	var out value
+	out.kind = kindVec4
+	copy(out.v[ : ], source.pix[offset : offset + 4])
+	return out
+}
+
+// Returns the size of the source image n, in pixels or texels.
+// Texture sizes are always considered equal to the image sizes.
+func (self *execContext) sourceSize(n int) value {
+	source := self.images[n]
+	if source == nil { return value{ kind: kindVec2 } }
+	if !self.unitPixels { return value{ kind: kindVec2, v: [4]float64{1, 1} } }
+	return value{ kind: kindVec2, v: [4]float64{ float64(source.width), float64(source.height) } }
+}
+
+// Source image with premultiplied float colors.
+type sourceImage struct {
+	width, height int
+	pix []float64
+}
+
+func newSourceImage(img image.Image) *sourceImage {
+	bounds := img.Bounds()
+	source := &sourceImage{
+		width: bounds.Dx(),
+		height: bounds.Dy(),
+		pix: make([]float64, bounds.Dx()*bounds.Dy()*4),
+	}
+	i := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			source.pix[i + 0] = float64(r)/65535.0
+			source.pix[i + 1] = float64(g)/65535.0
+			source.pix[i + 2] = float64(b)/65535.0
+			source.pix[i + 3] = float64(a)/65535.0
+			i += 4
+		}
+	}
+	return source
+}
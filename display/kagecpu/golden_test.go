@@ -0,0 +1,297 @@
+package kagecpu
+
+import "os"
+import "fmt"
+import "flag"
+import "sort"
+import "image"
+import "image/png"
+import "image/color"
+import "strings"
+import "testing"
+import "path/filepath"
+
+// Golden image regression checks for the bundled example shaders.
+//
+// Every shader under examples/intro, examples/learn and examples/misc
+// is rendered with fixed uniforms and times and compared against the
+// golden PNGs in testdata/golden. From the display directory:
+//   go test ./kagecpu -run Golden                  # check all examples
+//   go test ./kagecpu -run Golden/learn/           # only some cases
+//   go test ./kagecpu -run Golden -update          # rewrite the golden images
+//   go test ./kagecpu -run Golden -tolerance 4     # allow bigger differences
+//
+// When a case fails, the actual result and a diff image are written
+// to the -diffs directory. Diff images show matching pixels dimmed
+// and mismatching pixels in red, brighter for bigger differences.
+//
+// Results are the raw shader outputs (premultiplied alpha, without
+// the background color that display.Shader() draws beneath). The
+// uniforms and images for each example are configured below to match
+// what its main.go sets up. Procedural textures (images 2 and 3 in
+// display) are not available on the CPU.
+
+var goldenUpdate = flag.Bool("update", false, "write the current results as the new golden images")
+var goldenTolerance = flag.Int("tolerance", 2, "max per-channel difference allowed on golden images, from 0 to 255")
+var goldenDiffs = flag.String("diffs", "golden_diffs", "output directory for actual and diff images of failed golden cases")
+
+// Repository root and golden images directory, relative to this package.
+const goldenRoot, goldenDir = "../..", "testdata/golden"
+
+// Example groups with shaders to check.
+var exampleGroups = []string{ "intro", "learn", "misc" }
+
+// Values of Time used for shaders that declare it.
+var goldenTimes = []float32{ 0, 1.5 }
+
+// Fixed value for the Cursor uniform (normalized, like in display).
+var goldenCursor = []float32{ 0.5, 0.5 }
+
+const defaultWidth, defaultHeight = 512, 512
+
+// Settings for examples that don't follow the display.Shader()
+// defaults, mirroring what their main.go does. Keys are shader
+// paths relative to the examples directory.
+type exampleConfig struct {
+	width, height int
+	uniforms map[string]any
+	images [4]string // sample image names, "" for automatic
+}
+
+var exampleConfigs = map[string]exampleConfig{
+	"intro/checkerboard/shader.kage": { width: 256, height: 256 },
+	"intro/checkerboard-preview/shader.kage": { width: 256, height: 256 },
+	"intro/gradient/shader.kage": { width: 300, height: 300 },
+	"intro/circle/shader.kage": {
+		uniforms: map[string]any{ "Center": []float32{256, 256} },
+	},
+	"intro/circle-anim/shader.kage": {
+		uniforms: map[string]any{ "Center": []float32{256, 256}, "Radius": float32(80) },
+	},
+	"intro/color-swap/shader.kage": { width: 384, height: 384 },
+	"intro/spider-cat/shader.kage": { width: 384, height: 384 },
+	"intro/mirror/shader.kage": {
+		width: 384, height: 768,
+		uniforms: map[string]any{ "MirrorAlphaMult": float32(0.2), "VertDisplacement": 28 },
+	},
+	"intro/pixelize/shader.kage": { width: 384, height: 384 },
+	"intro/pixelize-anim/shader.kage": {
+		width: 384, height: 384,
+		uniforms: map[string]any{ "CellSize": float32(8) },
+	},
+	"misc/edge-extend/shader.kage": { images: [4]string{ "waterfall" } },
+	"misc/wrap/shader.kage": { images: [4]string{ "waterfall" } },
+	"misc/recolor/shader.kage": {
+		uniforms: map[string]any{
+			"DarkColor" : []float32{ 26/255.0, 0, 0, 1 },
+			"LightColor": []float32{ 51/255.0, 1, 1, 1 },
+		},
+	},
+	"misc/triangles/point.kage": {
+		width: 32, height: 32,
+		uniforms: map[string]any{ "Center": []float32{16, 16}, "Radius": float32(10) },
+	},
+}
+
+// Default images for each shader image index, like in display.
+var defaultImageNames = [4]string{ "spider_cat_dog", "waterfall", "", "" }
+
+type goldenCase struct {
+	name string // like "learn/filled-circle" or "intro/circle-anim@t1.50"
+	source []byte
+	width, height int
+	time float32
+	overrides map[string]any
+	images [4]image.Image
+}
+
+// Returns the golden image filename for the case.
+func (self goldenCase) filename() string {
+	name := strings.ReplaceAll(self.name, "/", "_")
+	return strings.ReplaceAll(name, "@", "_") + ".png"
+}
+
+// Returns the uniforms for the case: display's built-in uniforms
+// at fixed values, and then the example-specific ones.
+func (self goldenCase) uniforms(program *Program) map[string]any {
+	uniforms := map[string]any{
+		"Time": self.time,
+		"Cursor": goldenCursor,
+		"MouseButtons": 0,
+		"LastClickPos": []float32{0, 0},
+		"Resolution": []float32{ float32(self.width), float32(self.height) },
+	}
+	for _, name := range program.Uniforms() {
+		switch name {
+		case "Tick", "Frame": uniforms[name] = 0
+		case "DeltaTime": uniforms[name] = float32(0)
+		}
+	}
+	for name, value := range self.overrides {
+		uniforms[name] = value
+	}
+	return uniforms
+}
+
+func TestGolden(t *testing.T) {
+	if *goldenTolerance < 0 || *goldenTolerance > 255 { t.Fatal("tolerance must be between 0 and 255") }
+	_, err := os.Stat(filepath.Join(goldenRoot, "examples"))
+	if os.IsNotExist(err) { t.Skip("examples not found, golden tests need the full repository") }
+
+	cases, err := collectGoldenCases(goldenRoot)
+	if err != nil { t.Fatal(err) }
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkGoldenCase(c, *goldenTolerance, *goldenUpdate)
+			if err != nil { t.Fatal(err) }
+		})
+	}
+}
+
+// Finds all the example shaders and creates their cases.
+func collectGoldenCases(root string) ([]goldenCase, error) {
+	var images = make(map[string]image.Image)
+	loadImage := func(name string) (image.Image, error) {
+		img, found := images[name]
+		if found { return img, nil }
+		img, err := readPNG(filepath.Join(root, "display", name + ".png"))
+		if err != nil { return nil, err }
+		images[name] = img
+		return img, nil
+	}
+
+	var cases []goldenCase
+	for _, group := range exampleGroups {
+		paths, err := filepath.Glob(filepath.Join(root, "examples", group, "*", "*.kage"))
+		if err != nil { return nil, err }
+		sort.Strings(paths)
+		for _, path := range paths {
+			source, err := os.ReadFile(path)
+			if err != nil { return nil, err }
+			program, err := Compile(source)
+			if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+
+			relPath, err := filepath.Rel(filepath.Join(root, "examples"), path)
+			if err != nil { return nil, err }
+			relPath = filepath.ToSlash(relPath)
+			name := strings.TrimSuffix(relPath, "/shader.kage")
+			name = strings.TrimSuffix(name, ".kage")
+			config := exampleConfigs[relPath]
+
+			base := goldenCase{
+				name: name,
+				source: source,
+				width: config.width,
+				height: config.height,
+				overrides: config.uniforms,
+			}
+			if base.width == 0 { base.width, base.height = defaultWidth, defaultHeight }
+			for n := 0; n < 4; n++ {
+				imageName := config.images[n]
+				if imageName == "" && strings.Contains(string(source), fmt.Sprintf("imageSrc%d", n)) {
+					imageName = defaultImageNames[n]
+					if imageName == "" { return nil, fmt.Errorf("%s: image %d is not available on the CPU", path, n) }
+				}
+				if imageName == "" { continue }
+				base.images[n], err = loadImage(imageName)
+				if err != nil { return nil, err }
+			}
+
+			if !declaresUniform(program, "Time") {
+				cases = append(cases, base)
+				continue
+			}
+			for _, t := range goldenTimes {
+				timedCase := base
+				timedCase.name = fmt.Sprintf("%s@t%.2f", name, t)
+				timedCase.time = t
+				cases = append(cases, timedCase)
+			}
+		}
+	}
+	return cases, nil
+}
+
+func declaresUniform(program *Program, name string) bool {
+	for _, uniform := range program.Uniforms() {
+		if uniform == name { return true }
+	}
+	return false
+}
+
+func checkGoldenCase(c goldenCase, tolerance int, update bool) error {
+	program, err := Compile(c.source)
+	if err != nil { return err }
+	actual, err := program.Render(c.width, c.height, c.uniforms(program), c.images)
+	if err != nil { return err }
+
+	goldenPath := filepath.Join(goldenDir, c.filename())
+	if update { return writePNG(goldenPath, actual) }
+
+	golden, err := readPNG(goldenPath)
+	if os.IsNotExist(err) { return fmt.Errorf("missing golden image %s (run with -update to create it)", goldenPath) }
+	if err != nil { return err }
+	if golden.Bounds().Size() != actual.Bounds().Size() {
+		return fmt.Errorf("size mismatch: got %v, golden is %v", actual.Bounds().Size(), golden.Bounds().Size())
+	}
+
+	diff, mismatches, maxDelta := compareImages(actual, golden, tolerance)
+	if mismatches == 0 { return nil }
+
+	err = os.MkdirAll(*goldenDiffs, 0755)
+	if err != nil { return err }
+	base := strings.TrimSuffix(c.filename(), ".png")
+	err = writePNG(filepath.Join(*goldenDiffs, base + ".actual.png"), actual)
+	if err != nil { return err }
+	err = writePNG(filepath.Join(*goldenDiffs, base + ".diff.png"), diff)
+	if err != nil { return err }
+	return fmt.Errorf("%d pixels differ by more than %d (max difference %d, diffs at %s)", mismatches, tolerance, maxDelta, *goldenDiffs)
+}
+
+// Compares the images channel by channel. Returns a diff image, the
+// number of pixels exceeding the tolerance and the max difference.
+func compareImages(actual, golden image.Image, tolerance int) (*image.RGBA, int, int) {
+	bounds := actual.Bounds()
+	goldenMin := golden.Bounds().Min
+	diff := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	var mismatches, maxDelta int
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			a := color.RGBAModel.Convert(actual.At(bounds.Min.X + x, bounds.Min.Y + y)).(color.RGBA)
+			g := color.RGBAModel.Convert(golden.At(goldenMin.X + x, goldenMin.Y + y)).(color.RGBA)
+			delta := maxInt(
+				maxInt(absDiff(a.R, g.R), absDiff(a.G, g.G)),
+				maxInt(absDiff(a.B, g.B), absDiff(a.A, g.A)),
+			)
+			maxDelta = maxInt(maxDelta, delta)
+			if delta > tolerance {
+				mismatches += 1
+				diff.SetRGBA(x, y, color.RGBA{ uint8(128 + delta/2), 0, 0, 255 })
+			} else {
+				luma := uint8((int(g.R)*3 + int(g.G)*6 + int(g.B))/40) // dimmed
+				diff.SetRGBA(x, y, color.RGBA{ luma, luma, luma, 255 })
+			}
+		}
+	}
+	return diff, mismatches, maxDelta
+}
+
+func readPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer file.Close()
+	return png.Decode(file)
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil { return err }
+	err = png.Encode(file, img)
+	if err != nil {
+		file.Close() // ignoring close error
+		return err
+	}
+	return file.Close()
+}
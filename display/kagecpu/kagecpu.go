@@ -0,0 +1,378 @@
+// A CPU reference interpreter for a subset of Kage, the shading
+// language of Ebitengine. It's slow, but it doesn't need a GPU nor
+// a window, so it can be used to unit-test shader math on CI and to
+// cross-check GPU results:
+//   program, err := kagecpu.Compile(shaderSource)
+//   if err != nil { t.Fatal(err) }
+//   img, err := program.Render(64, 64, map[string]any{"Time": float32(1.5)}, [4]image.Image{})
+//   if err != nil { t.Fatal(err) }
+//   // ...check img pixels
+//
+// Programs are rendered with the same conventions as display.Shader():
+// the destination covers the whole target, source coordinates span
+// the first non-nil image (or the target itself if there are no
+// images) and the vertex colors are red, green, blue and yellow on
+// the top-left, top-right, bottom-left and bottom-right corners. As
+// long as all the images have the same size, the results should be
+// comparable to display.RenderShaderToImage() with [display.MapStretch]
+// mappings, except for floating point precision differences. Unlike
+// display, nil images are not replaced by default images. Both
+// '//kage:unit pixels' and texel units are supported.
+//
+// Derivative functions (dFdx, dFdy, fwidth) are computed in 2x2 pixel
+// quads like GPUs do, running the Fragment function twice per pixel.
+//
+// The interpreter doesn't support matrices, arrays, switch statements
+// nor labels. Kage programs are not fully type-checked either, so some
+// programs that would fail to compile with Ebitengine may still run
+// here. Use it as a reference for shader math, not as a validator.
+package kagecpu
+
+import "fmt"
+import "image"
+import "errors"
+import "reflect"
+import "runtime"
+import "strings"
+import "sync"
+import "sync/atomic"
+import "go/ast"
+import "go/token"
+import "go/parser"
+
+// A compiled Kage program. Safe for concurrent use.
+type Program struct {
+	funcs map[string]*function
+	fragment *function
+	uniforms map[string]int
+	uniformKinds []kind
+	unitPixels bool
+	usesDerivatives bool
+}
+
+// Parses and compiles the given Kage program.
+func Compile(program []byte) (prog *Program, err error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", program, parser.ParseComments)
+	if err != nil { return nil, err }
+
+	compiler := &compiler{
+		consts: make(map[string]value),
+		uniforms: make(map[string]int),
+		funcs: make(map[string]*function),
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			compileErr, isCompileErr := r.(compileError)
+			if !isCompileErr { panic(r) }
+			prog, err = nil, errors.New(fset.Position(compileErr.pos).String() + ": " + compileErr.msg)
+		}
+	}()
+
+	// declarations
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.VAR:
+				compiler.declareUniforms(decl)
+			case token.CONST:
+				compiler.declareConsts(decl, func(name *ast.Ident, val value) {
+					if name.Name == "_" { return }
+					if compiler.isDeclared(name.Name) { compiler.failf(name, "%s redeclared", name.Name) }
+					compiler.consts[name.Name] = val
+				})
+			default:
+				compiler.failf(decl, "%s declarations are not supported", decl.Tok)
+			}
+		case *ast.FuncDecl:
+			compiler.declareFunc(decl)
+		}
+	}
+
+	// function bodies
+	for _, decl := range file.Decls {
+		funcDecl, isFunc := decl.(*ast.FuncDecl)
+		if isFunc { compiler.compileFunc(compiler.funcs[funcDecl.Name.Name]) }
+	}
+
+	fragment := compiler.funcs["Fragment"]
+	if fragment == nil { return nil, errors.New("missing Fragment function") }
+	if len(fragment.resultKinds) != 1 || fragment.resultKinds[0] != kindVec4 {
+		return nil, errors.New("Fragment must return a single vec4")
+	}
+	expectedParams := []kind{kindVec4, kindVec2, kindVec4}
+	if len(fragment.paramKinds) > len(expectedParams) {
+		return nil, errors.New("Fragment can't have more than 3 parameters")
+	}
+	for i, paramKind := range fragment.paramKinds {
+		if paramKind != expectedParams[i] {
+			return nil, fmt.Errorf("Fragment parameter #%d must be %s", i, expectedParams[i])
+		}
+	}
+
+	return &Program{
+		funcs: compiler.funcs,
+		fragment: fragment,
+		uniforms: compiler.uniforms,
+		uniformKinds: compiler.uniformKinds,
+		unitPixels: hasPixelsUnit(file),
+		usesDerivatives: compiler.usesDerivatives,
+	}, nil
+}
+
+// Returns the names of the uniforms declared by the program, in
+// declaration order.
+func (self *Program) Uniforms() []string {
+	names := make([]string, len(self.uniformKinds))
+	for name, index := range self.uniforms {
+		names[index] = name
+	}
+	return names
+}
+
+func hasPixelsUnit(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if strings.TrimSpace(comment.Text) == "//kage:unit pixels" { return true }
+		}
+	}
+	return false
+}
+
+// Renders the program to a new image of the given size. Uniforms are
+// given by name, with the same value types accepted by Ebitengine
+// (float32, int, []float32, etc.). Undeclared uniforms are ignored and
+// unset uniforms are zero. The result has premultiplied alpha.
+//
+// The work is split across all the available CPUs.
+func (self *Program) Render(width, height int, uniforms map[string]any, images [4]image.Image) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 { panic("width and height must be strictly positive") }
+	uniformValues, err := self.uniformValues(uniforms)
+	if err != nil { return nil, err }
+
+	var sources [4]*sourceImage
+	srcSize := image.Pt(width, height)
+	foundSrc := false
+	for n, img := range images {
+		if img == nil { continue }
+		sources[n] = newSourceImage(img)
+		if !foundSrc { srcSize = img.Bounds().Size() }
+		foundSrc = true
+	}
+
+	target := image.NewRGBA(image.Rect(0, 0, width, height))
+	var nextRow int64 = -2
+	var firstErr error
+	var errMutex sync.Mutex
+	var group sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			ctx := &execContext{
+				uniforms: uniformValues,
+				images: sources,
+				unitPixels: self.unitPixels,
+				dstWidth: float64(width),
+				dstHeight: float64(height),
+				srcWidth: float64(srcSize.X),
+				srcHeight: float64(srcSize.Y),
+			}
+			for {
+				y := int(atomic.AddInt64(&nextRow, 2))
+				if y >= height { return }
+				err := self.renderRows(ctx, target, y)
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil { firstErr = err }
+					errMutex.Unlock()
+					atomic.StoreInt64(&nextRow, int64(height))
+					return
+				}
+			}
+		}()
+	}
+	group.Wait()
+	if firstErr != nil { return nil, firstErr }
+	return target, nil
+}
+
+// Renders rows y and y + 1 of the target.
+func (self *Program) renderRows(ctx *execContext, target *image.RGBA, y int) (err error) {
+	defer func() { err = recoverRuntimeError(recover(), ctx) }()
+	width, height := target.Bounds().Dx(), target.Bounds().Dy()
+	for x := 0; x < width; x += 2 {
+		if self.usesDerivatives {
+			ctx.derivMode = derivRecord
+			for lane := 0; lane < 4; lane++ {
+				ctx.lane = lane
+				ctx.quad[lane] = ctx.quad[lane][ : 0]
+				self.runFragment(ctx, x + lane & 1, y + lane >> 1)
+			}
+			ctx.derivMode = derivApply
+		}
+		for lane := 0; lane < 4; lane++ {
+			px, py := x + lane & 1, y + lane >> 1
+			if px >= width || py >= height { continue }
+			ctx.lane = lane
+			ctx.derivIndex = 0
+			rgba, discarded := self.runFragment(ctx, px, py)
+			if discarded { continue }
+			offset := target.PixOffset(px, py)
+			for i := 0; i < 4; i++ {
+				target.Pix[offset + i] = uint8(clampUnit(rgba.v[i])*255 + 0.5)
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the Fragment function for the given target pixel.
+func (self *Program) runFragment(ctx *execContext, x, y int) (result value, discarded bool) {
+	defer func() {
+		r := recover()
+		if r == nil { return }
+		if r != errDiscard { panic(r) }
+		ctx.stack, ctx.depth = ctx.stack[ : 0], 0
+		discarded = true
+	}()
+
+	u := (float64(x) + 0.5)/ctx.dstWidth
+	v := (float64(y) + 0.5)/ctx.dstHeight
+	args := [3]value{
+		{ kind: kindVec4, v: [4]float64{ float64(x) + 0.5, float64(y) + 0.5, 0, 1 } },
+		{ kind: kindVec2, v: [4]float64{ u, v } },
+		{ kind: kindVec4, v: vertexColor(u, v) },
+	}
+	if self.unitPixels {
+		args[1].v[0] *= ctx.srcWidth
+		args[1].v[1] *= ctx.srcHeight
+	}
+	var evals [3]evalFn
+	for i := range self.fragment.paramKinds {
+		val := args[i]
+		evals[i] = func(frame) value { return val }
+	}
+	self.fragment.call(frame{ ctx: ctx }, evals[ : len(self.fragment.paramKinds)])
+	return ctx.returns[0], false
+}
+
+// Interpolates the vertex colors (red, green, blue and yellow, from
+// top-left to bottom-right) across the two triangles of the target.
+func vertexColor(u, v float64) [4]float64 {
+	if u + v <= 1 { // top-left triangle
+		return [4]float64{ 1 - u - v, u, v, 1 }
+	}
+	yellow := u + v - 1
+	return [4]float64{ yellow, (1 - v) + yellow, 1 - u, 1 }
+}
+
+// Calls the given function with the given arguments, which can be
+// bools, ints, floats or slices of ints or floats for vectors. Results
+// are returned as bool, int, float64, []int or []float64. Uniforms
+// work like in [Program.Render](), but images are not available.
+//
+// Mainly useful to unit-test shader helper functions.
+func (self *Program) Call(uniforms map[string]any, name string, args ...any) (results []any, err error) {
+	fn := self.funcs[name]
+	if fn == nil { return nil, errors.New("undefined function " + name) }
+	if len(args) != len(fn.paramKinds) {
+		return nil, fmt.Errorf("wrong number of arguments in call to %s(): have %d, want %d", name, len(args), len(fn.paramKinds))
+	}
+	uniformValues, err := self.uniformValues(uniforms)
+	if err != nil { return nil, err }
+	evals := make([]evalFn, len(args))
+	for i, arg := range args {
+		val, err := goToValue(arg, fn.paramKinds[i])
+		if err != nil { return nil, fmt.Errorf("argument #%d: %w", i, err) }
+		evals[i] = constEval(val)
+	}
+
+	ctx := &execContext{ uniforms: uniformValues, unitPixels: self.unitPixels }
+	defer func() {
+		err = recoverRuntimeError(recover(), ctx)
+		if err != nil { results = nil }
+	}()
+	fn.call(frame{ ctx: ctx }, evals)
+	for _, val := range ctx.returns {
+		results = append(results, valueToGo(val))
+	}
+	return results, nil
+}
+
+func (self *Program) uniformValues(uniforms map[string]any) ([]value, error) {
+	values := make([]value, len(self.uniformKinds))
+	for i, uniformKind := range self.uniformKinds {
+		values[i] = value{ kind: uniformKind }
+	}
+	for name, uniform := range uniforms {
+		index, found := self.uniforms[name]
+		if !found { continue }
+		val, err := goToValue(uniform, self.uniformKinds[index])
+		if err != nil { return nil, fmt.Errorf("uniform %s: %w", name, err) }
+		values[index] = val
+	}
+	return values, nil
+}
+
+func goToValue(x any, target kind) (value, error) {
+	rv := reflect.ValueOf(x)
+	var components []float64
+	switch rv.Kind() {
+	case reflect.Bool:
+		if target != kindBool { return value{}, fmt.Errorf("can't use bool as %s", target) }
+		return boolValue(rv.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			component, isNumber := reflectNumber(rv.Index(i))
+			if !isNumber { return value{}, fmt.Errorf("can't use %T as %s", x, target) }
+			components = append(components, component)
+		}
+	default:
+		component, isNumber := reflectNumber(rv)
+		if !isNumber { return value{}, fmt.Errorf("can't use %T as %s", x, target) }
+		components = append(components, component)
+	}
+	if target == kindBool || len(components) != target.size() {
+		return value{}, fmt.Errorf("can't use %d numeric components as %s", len(components), target)
+	}
+
+	val := value{ kind: target }
+	copy(val.v[ : ], components)
+	if target.isInt() { val = castTo(val, target) }
+	return val, nil
+}
+
+func reflectNumber(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	default:
+		return 0, false
+	}
+}
+
+func valueToGo(val value) any {
+	switch val.kind {
+	case kindBool: return val.isTrue()
+	case kindInt: return int(val.v[0])
+	case kindFloat: return val.v[0]
+	case kindIVec2, kindIVec3, kindIVec4:
+		ints := make([]int, val.kind.size())
+		for i := range ints { ints[i] = int(val.v[i]) }
+		return ints
+	default:
+		return append([]float64(nil), val.v[ : val.kind.size()]...)
+	}
+}
+
+func clampUnit(x float64) float64 {
+	if !(x > 0) { return 0 } // (also catches NaNs)
+	if x >= 1 { return 1 }
+	return x
+}
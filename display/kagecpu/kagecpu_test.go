@@ -0,0 +1,498 @@
+package kagecpu
+
+import "math"
+import "image"
+import "reflect"
+import "strings"
+import "testing"
+import "image/color"
+
+const testProgram = `package main
+
+var Scale float
+
+func Fragment(targetCoords vec4, srcPos vec2, color vec4) vec4 {
+	return vec4(0)
+}
+
+func add(a, b float) float { return a + b }
+func sub(a, b float) float { return a - b }
+func mul(a, b float) float { return a * b }
+func div(a, b float) float { return a / b }
+func idiv(a, b int) int { return a / b }
+func irem(a, b int) int { return a % b }
+func neg(v vec3) vec3 { return -v }
+func vecMul(v vec3, s float) vec3 { return v*s }
+func vecAdd(a, b vec2) vec2 { return a + b }
+func scaled(x float) float { return x*Scale }
+
+func less(a, b float) bool { return a < b }
+func lessEq(a, b float) bool { return a <= b }
+func equal(a, b float) bool { return a == b }
+func notEqual(a, b int) bool { return a != b }
+func vecEqual(a, b vec2) bool { return a == b }
+func both(a, b bool) bool { return a && !b }
+
+func fnMix(a, b vec2, t float) vec2 { return mix(a, b, t) }
+func fnClamp(x vec3) vec3 { return clamp(x, 0, 1) }
+func fnClampInt(x int) int { return clamp(x, 0, 10) }
+func fnStep(edge, x float) float { return step(edge, x) }
+func fnSmoothstep(x float) float { return smoothstep(0, 2, x) }
+func fnMod(x, y float) float { return mod(x, y) }
+func fnAtan2(y, x float) float { return atan2(y, x) }
+func fnLength(v vec2) float { return length(v) }
+func fnNormalize(v vec2) vec2 { return normalize(v) }
+func fnDot(a, b vec3) float { return dot(a, b) }
+func fnCross(a, b vec3) vec3 { return cross(a, b) }
+func fnFract(x float) float { return fract(x) }
+
+func swizzleRead(v vec4) vec3 { return v.zyx }
+func swizzleRepeat(v vec2) vec4 { return v.xxyy }
+func swizzleColor(v vec4) vec2 { return v.ar }
+func swizzleWrite(v vec4) vec4 {
+	v.xz = vec2(7, 8)
+	return v
+}
+func swizzleAddAssign(v vec3) vec3 {
+	v.yz += 1
+	return v
+}
+func indexWrite(v vec3) vec3 {
+	v[1] = 5
+	return v
+}
+
+func ctorSplat() vec4 { return vec4(0.5) }
+func ctorMixed(v vec2) vec4 { return vec4(v, 3, 4) }
+func ctorNested(v vec2) vec3 { return vec3(1, v.yx) }
+func ctorIVec(x float) ivec2 { return ivec2(x, -x) }
+func ctorConvert(x float) int { return int(x) }
+func ctorFloat(x int) float { return float(x) / 2 }
+
+const Limit = 10
+const Half = Limit / 4.0
+
+func sumTo(n int) int {
+	sum := 0
+	for i := 1; i <= n; i++ {
+		if i % 2 == 0 { continue }
+		if i > Limit { break }
+		sum += i
+	}
+	return sum
+}
+func sign3(x float) int {
+	if x < 0 {
+		return -1
+	} else if x == 0 {
+		return 0
+	}
+	return 1
+}
+func countdown(n int) int {
+	steps := 0
+	for n > 0 {
+		n--
+		steps++
+	}
+	return steps
+}
+func earlyReturn(x float) float {
+	for i := 0; i < 100; i++ {
+		if float(i) >= x { return float(i) }
+	}
+	return -1
+}
+func shadow(x float) float {
+	y := x
+	if x > 0 {
+		y := 2*x
+		_ = y
+	}
+	return y
+}
+func swap(a, b float) (float, float) { return b, a }
+func swapTwice(a, b float) (float, float) { return swap(b, a) }
+func named(x float) (half float, double float) {
+	half = x*Half/Limit*2
+	double = x*2
+	return
+}
+func multiAssign(a, b float) float {
+	a, b = b, a
+	x, y := swap(a, b)
+	return x - y
+}
+
+func fnReflect(i, n vec2) vec2 { return reflect(i, n) }
+func fnDistance(a, b vec2) float { return distance(a, b) }
+func fnSign(v vec3) vec3 { return sign(v) }
+func fnAbsInt(x int) int { return abs(x) }
+func fnPow(x vec2) vec2 { return pow(x, vec2(2, 0.5)) }
+func fnMaxInt(a, b int) int { return max(a, b) }
+func fnFloor(v vec2) vec2 { return floor(v) }
+`
+
+func TestCall(t *testing.T) {
+	program, err := Compile([]byte(testProgram))
+	if err != nil { t.Fatal(err) }
+	uniforms := map[string]any{ "Scale": float32(3) }
+
+	tests := []struct {
+		fn string
+		args []any
+		want any
+	}{
+		// arithmetic
+		{ "add", []any{ 1.5, 2 }, 3.5 },
+		{ "sub", []any{ 1, 2.5 }, -1.5 },
+		{ "mul", []any{ -2, 0.25 }, -0.5 },
+		{ "div", []any{ 1, 4 }, 0.25 },
+		{ "idiv", []any{ 7, 2 }, 3 },
+		{ "idiv", []any{ -7, 2 }, -3 },
+		{ "irem", []any{ -7, 3 }, -1 },
+		{ "neg", []any{ []float32{ 1, -2, 0 } }, []float64{ -1, 2, 0 } },
+		{ "vecMul", []any{ []float32{ 1, 2, 3 }, 0.5 }, []float64{ 0.5, 1, 1.5 } },
+		{ "vecAdd", []any{ []float32{ 1, 2 }, []float32{ 3, 4 } }, []float64{ 4, 6 } },
+		{ "scaled", []any{ 2 }, 6.0 },
+
+		// comparisons
+		{ "less", []any{ 1, 2 }, true },
+		{ "less", []any{ 2, 2 }, false },
+		{ "lessEq", []any{ 2, 2 }, true },
+		{ "equal", []any{ 0.5, 0.5 }, true },
+		{ "notEqual", []any{ 3, 3 }, false },
+		{ "vecEqual", []any{ []float32{ 1, 2 }, []float32{ 1, 2 } }, true },
+		{ "vecEqual", []any{ []float32{ 1, 2 }, []float32{ 1, 3 } }, false },
+		{ "both", []any{ true, false }, true },
+		{ "both", []any{ true, true }, false },
+
+		// builtins
+		{ "fnMix", []any{ []float32{ 0, 10 }, []float32{ 1, 20 }, 0.25 }, []float64{ 0.25, 12.5 } },
+		{ "fnClamp", []any{ []float32{ -1, 0.5, 2 } }, []float64{ 0, 0.5, 1 } },
+		{ "fnClampInt", []any{ 12 }, 10 },
+		{ "fnStep", []any{ 0.5, 0.4 }, 0.0 },
+		{ "fnStep", []any{ 0.5, 0.5 }, 1.0 },
+		{ "fnSmoothstep", []any{ -1 }, 0.0 },
+		{ "fnSmoothstep", []any{ 1 }, 0.5 },
+		{ "fnSmoothstep", []any{ 3 }, 1.0 },
+		{ "fnMod", []any{ 5.5, 2 }, 1.5 },
+		{ "fnMod", []any{ -1, 3 }, 2.0 }, // GLSL mod, not Go's math.Mod
+		{ "fnAtan2", []any{ 1, 0 }, math.Pi/2 },
+		{ "fnAtan2", []any{ 0, -1 }, math.Pi },
+		{ "fnLength", []any{ []float32{ 3, 4 } }, 5.0 },
+		{ "fnNormalize", []any{ []float32{ 0, -2 } }, []float64{ 0, -1 } },
+		{ "fnDot", []any{ []float32{ 1, 2, 3 }, []float32{ 4, 5, 6 } }, 32.0 },
+		{ "fnCross", []any{ []float32{ 1, 0, 0 }, []float32{ 0, 1, 0 } }, []float64{ 0, 0, 1 } },
+		{ "fnFract", []any{ -0.25 }, 0.75 },
+
+		// swizzles
+		{ "swizzleRead", []any{ []float32{ 1, 2, 3, 4 } }, []float64{ 3, 2, 1 } },
+		{ "swizzleRepeat", []any{ []float32{ 1, 2 } }, []float64{ 1, 1, 2, 2 } },
+		{ "swizzleColor", []any{ []float32{ 1, 2, 3, 4 } }, []float64{ 4, 1 } },
+		{ "swizzleWrite", []any{ []float32{ 1, 2, 3, 4 } }, []float64{ 7, 2, 8, 4 } },
+		{ "swizzleAddAssign", []any{ []float32{ 1, 2, 3 } }, []float64{ 1, 3, 4 } },
+		{ "indexWrite", []any{ []float32{ 1, 2, 3 } }, []float64{ 1, 5, 3 } },
+
+		// constructors and conversions
+		{ "ctorSplat", nil, []float64{ 0.5, 0.5, 0.5, 0.5 } },
+		{ "ctorMixed", []any{ []float32{ 1, 2 } }, []float64{ 1, 2, 3, 4 } },
+		{ "ctorNested", []any{ []float32{ 2, 3 } }, []float64{ 1, 3, 2 } },
+		{ "ctorIVec", []any{ 2.7 }, []int{ 2, -2 } },
+		{ "ctorConvert", []any{ -1.5 }, -1 },
+		{ "ctorFloat", []any{ 3 }, 1.5 },
+
+		// control flow, consts and multiple returns
+		{ "sumTo", []any{ 7 }, 16 },
+		{ "sumTo", []any{ 50 }, 25 },
+		{ "sign3", []any{ -0.5 }, -1 },
+		{ "sign3", []any{ 0 }, 0 },
+		{ "sign3", []any{ 2 }, 1 },
+		{ "countdown", []any{ 4 }, 4 },
+		{ "earlyReturn", []any{ 2.5 }, 3.0 },
+		{ "earlyReturn", []any{ 200 }, -1.0 },
+		{ "shadow", []any{ 3 }, 3.0 },
+		{ "multiAssign", []any{ 1, 3 }, -2.0 },
+
+		// more builtins
+		{ "fnReflect", []any{ []float32{ 1, -1 }, []float32{ 0, 1 } }, []float64{ 1, 1 } },
+		{ "fnDistance", []any{ []float32{ 1, 1 }, []float32{ 4, 5 } }, 5.0 },
+		{ "fnSign", []any{ []float32{ -3, 0, 0.5 } }, []float64{ -1, 0, 1 } },
+		{ "fnAbsInt", []any{ -4 }, 4 },
+		{ "fnPow", []any{ []float32{ 3, 16 } }, []float64{ 9, 4 } },
+		{ "fnMaxInt", []any{ -2, 5 }, 5 },
+		{ "fnFloor", []any{ []float32{ -0.5, 1.5 } }, []float64{ -1, 1 } },
+	}
+
+	for _, test := range tests {
+		results, err := program.Call(uniforms, test.fn, test.args...)
+		if err != nil {
+			t.Errorf("%s%v: %s", test.fn, test.args, err)
+			continue
+		}
+		if len(results) != 1 || !approxEqual(results[0], test.want) {
+			t.Errorf("%s%v: got %v, want %v", test.fn, test.args, results, test.want)
+		}
+	}
+}
+
+func TestCallMultipleResults(t *testing.T) {
+	program, err := Compile([]byte(testProgram))
+	if err != nil { t.Fatal(err) }
+
+	tests := []struct {
+		fn string
+		args []any
+		want []any
+	}{
+		{ "swap", []any{ 1, 2 }, []any{ 2.0, 1.0 } },
+		{ "swapTwice", []any{ 1, 2 }, []any{ 1.0, 2.0 } },
+		{ "named", []any{ 4 }, []any{ 2.0, 8.0 } },
+	}
+	for _, test := range tests {
+		results, err := program.Call(nil, test.fn, test.args...)
+		if err != nil {
+			t.Errorf("%s%v: %s", test.fn, test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(results, test.want) {
+			t.Errorf("%s%v: got %v, want %v", test.fn, test.args, results, test.want)
+		}
+	}
+}
+
+func approxEqual(got, want any) bool {
+	switch typedWant := want.(type) {
+	case float64:
+		typedGot, isFloat := got.(float64)
+		return isFloat && math.Abs(typedGot - typedWant) < 1e-9
+	case []float64:
+		typedGot, isFloats := got.([]float64)
+		if !isFloats || len(typedGot) != len(typedWant) { return false }
+		for i := range typedWant {
+			if math.Abs(typedGot[i] - typedWant[i]) >= 1e-9 { return false }
+		}
+		return true
+	default:
+		return reflect.DeepEqual(got, want)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	program, err := Compile([]byte(testProgram))
+	if err != nil { t.Fatal(err) }
+
+	tests := []struct {
+		fn string
+		args []any
+		errPart string
+	}{
+		{ "missing", nil, "undefined function" },
+		{ "add", []any{ 1 }, "wrong number of arguments" },
+		{ "vecAdd", []any{ []float32{ 1, 2, 3 }, []float32{ 1, 2 } }, "argument #0" },
+		{ "both", []any{ 1, true }, "argument #0" },
+		{ "idiv", []any{ 1, 0 }, "division by zero" },
+		{ "fnAbsInt", []any{ []int{ 1, 2 } }, "argument #0" },
+	}
+	for _, test := range tests {
+		_, err := program.Call(nil, test.fn, test.args...)
+		if err == nil || !strings.Contains(err.Error(), test.errPart) {
+			t.Errorf("%s%v: expected error containing '%s', got %v", test.fn, test.args, test.errPart, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		errPart string
+	}{
+		{ "x := undefinedThing", "undefined: undefinedThing" },
+		{ "Scale = 1", "cannot assign to uniform" },
+		{ "v := vec2(1); v.xx = vec2(1)", "repeated components" },
+		{ "v := vec2(1); _ = v.xk", "invalid swizzle" },
+		{ "v := vec4(1); _ = v.xg", "invalid swizzle" }, // mixed sets
+		{ "m := mat2(1); _ = m", "undefined: mat2" }, // matrices are not supported
+		{ "for { break L }", "labels are not supported" },
+		{ "x := 1; x", "is not used" },
+		{ "_ = undefinedFunc(1)", "undefined: undefinedFunc" },
+	}
+	for _, test := range tests {
+		program := "package main\nvar Scale float\nfunc Fragment(dst vec4, src vec2, color vec4) vec4 {\n" +
+			test.body + "\nreturn vec4(0)\n}\n"
+		_, err := Compile([]byte(program))
+		if err == nil || !strings.Contains(err.Error(), test.errPart) {
+			t.Errorf("'%s': expected error containing '%s', got %v", test.body, test.errPart, err)
+		}
+	}
+}
+
+func TestUniforms(t *testing.T) {
+	program, err := Compile([]byte(`package main
+
+var Time float
+var Center, Size vec2
+var Flags ivec2
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 {
+	return vec4(Center/Size, Time, float(Flags.x + Flags.y))
+}
+`))
+	if err != nil { t.Fatal(err) }
+	if names := program.Uniforms(); !reflect.DeepEqual(names, []string{ "Time", "Center", "Size", "Flags" }) {
+		t.Fatalf("unexpected uniforms %v", names)
+	}
+	uniforms := map[string]any{
+		"Time": float32(0.5),
+		"Center": []float32{ 1, 2 },
+		"Size": [2]float64{ 4, 4 },
+		"Flags": []int32{ 0, 1 },
+		"Unknown": "ignored",
+	}
+	img, err := program.Render(1, 1, uniforms, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+	want := color.RGBA{ toByte(0.25), toByte(0.5), toByte(0.5), 255 }
+	if got := img.RGBAAt(0, 0); got != want { t.Errorf("got %v, want %v", got, want) }
+
+	for name, badValue := range map[string]any{ "Time": true, "Center": []float32{ 1 }, "Flags": "x" } {
+		_, err := program.Render(1, 1, map[string]any{ name: badValue }, [4]image.Image{})
+		if err == nil || !strings.Contains(err.Error(), "uniform " + name) {
+			t.Errorf("%s = %v: expected uniform error, got %v", name, badValue, err)
+		}
+	}
+}
+
+func TestRenderImages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.SetRGBA(0, 0, color.RGBA{ 255, 0, 0, 255 })
+	src.SetRGBA(1, 0, color.RGBA{ 0, 255, 0, 255 })
+	src.SetRGBA(0, 1, color.RGBA{ 0, 0, 255, 255 })
+	src.SetRGBA(1, 1, color.RGBA{ 0, 0, 0, 0 })
+
+	// texel units: a 4x4 target stretches the 2x2 source
+	program, err := Compile([]byte(`package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 {
+	if src.x > imageSrc0Size().x { discard() }
+	return imageSrc0At(src)
+}
+`))
+	if err != nil { t.Fatal(err) }
+	img, err := program.Render(4, 4, nil, [4]image.Image{ src })
+	if err != nil { t.Fatal(err) }
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if got, want := img.RGBAAt(x, y), src.RGBAAt(x/2, y/2); got != want {
+				t.Errorf("texels, pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	// pixel units, sampling out of bounds and discarding
+	program, err = Compile([]byte(`//kage:unit pixels
+
+package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 {
+	if dst.y > 1 { discard() }
+	if imageSrc0Size().x != 2 { return vec4(1) }
+	return imageSrc0At(src + vec2(1, 0))
+}
+`))
+	if err != nil { t.Fatal(err) }
+	img, err = program.Render(2, 2, nil, [4]image.Image{ src })
+	if err != nil { t.Fatal(err) }
+	wants := []color.RGBA{ src.RGBAAt(1, 0), {}, {}, {} }
+	for i, want := range wants {
+		if got := img.RGBAAt(i % 2, i / 2); got != want {
+			t.Errorf("pixels, pixel (%d, %d): got %v, want %v", i % 2, i / 2, got, want)
+		}
+	}
+}
+
+func TestVertexColors(t *testing.T) {
+	program, err := Compile([]byte(`package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 { return color }
+`))
+	if err != nil { t.Fatal(err) }
+	img, err := program.Render(64, 64, nil, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+	corners := map[image.Point]color.RGBA{
+		{ 0, 0 }: { 255, 0, 0, 255 }, { 63, 0 }: { 0, 255, 0, 255 },
+		{ 0, 63 }: { 0, 0, 255, 255 }, { 63, 63 }: { 255, 255, 0, 255 },
+	}
+	for pt, want := range corners {
+		got := img.RGBAAt(pt.X, pt.Y)
+		if absDiff(got.R, want.R) > 8 || absDiff(got.G, want.G) > 8 || absDiff(got.B, want.B) > 8 || got.A != 255 {
+			t.Errorf("corner %v: got %v, want close to %v", pt, got, want)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	program, err := Compile([]byte(`package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 {
+	for {
+		dst.x += 1
+	}
+	return dst
+}
+`))
+	if err != nil { t.Fatal(err) }
+	_, err = program.Render(2, 2, nil, [4]image.Image{})
+	if err == nil || !strings.Contains(err.Error(), "loop exceeded") {
+		t.Fatalf("expected loop limit error, got %v", err)
+	}
+}
+
+func TestDerivatives(t *testing.T) {
+	// dst.x grows by 1 per pixel and dst.y*dst.y grows by 2*y + 1 per
+	// pixel, so derivatives are constant along each 2x2 quad
+	program, err := Compile([]byte(`package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 {
+	dx := dFdx(dst.x*0.25)
+	dy := dFdy(dst.y*dst.y/16)
+	fw := fwidth(dst.x*0.125 - dst.y*0.125)
+	return vec4(dx, dy, fw, 1)
+}
+`))
+	if err != nil { t.Fatal(err) }
+	img, err := program.Render(4, 4, nil, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			// the derivatives use the top-left values of each quad row / column
+			quadY := float64(y &^ 1) + 0.5
+			wantDy := ((quadY + 1)*(quadY + 1) - quadY*quadY)/16
+			want := color.RGBA{ toByte(0.25), toByte(wantDy), toByte(0.25), 255 }
+			if got := img.RGBAAt(x, y); got != want {
+				t.Errorf("pixel (%d, %d): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDerivativesWithoutQuads(t *testing.T) {
+	program, err := Compile([]byte(`package main
+
+func Fragment(dst vec4, src vec2, color vec4) vec4 { return vec4(0) }
+func deriv(x float) float { return dFdx(x) + fwidth(x) }
+`))
+	if err != nil { t.Fatal(err) }
+	results, err := program.Call(nil, "deriv", 3.0)
+	if err != nil { t.Fatal(err) }
+	if results[0] != 0.0 { t.Fatalf("expected zero derivatives outside Render(), got %v", results[0]) }
+}
+
+func absDiff(a, b uint8) int {
+	if a > b { return int(a - b) }
+	return int(b - a)
+}
+
+func toByte(x float64) uint8 {
+	return uint8(clampUnit(x)*255 + 0.5)
+}
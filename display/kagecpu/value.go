@@ -0,0 +1,262 @@
+package kagecpu
+
+import "fmt"
+import "math"
+import "strings"
+import "go/token"
+
+type kind uint8
+const (
+	kindVoid kind = iota
+	kindBool
+	kindInt
+	kindFloat
+	kindVec2
+	kindVec3
+	kindVec4
+	kindIVec2
+	kindIVec3
+	kindIVec4
+)
+
+var kindNames = map[string]kind{
+	"bool": kindBool, "int": kindInt, "float": kindFloat,
+	"vec2": kindVec2, "vec3": kindVec3, "vec4": kindVec4,
+	"ivec2": kindIVec2, "ivec3": kindIVec3, "ivec4": kindIVec4,
+}
+
+func (self kind) String() string {
+	for name, k := range kindNames {
+		if k == self { return name }
+	}
+	return "void"
+}
+
+// Returns the number of components (1 for scalars, 0 for void).
+func (self kind) size() int {
+	switch self {
+	case kindVoid: return 0
+	case kindVec2, kindIVec2: return 2
+	case kindVec3, kindIVec3: return 3
+	case kindVec4, kindIVec4: return 4
+	default:
+		return 1
+	}
+}
+
+func (self kind) isInt() bool {
+	return self == kindInt || (self >= kindIVec2 && self <= kindIVec4)
+}
+
+func (self kind) isFloat() bool {
+	return self >= kindFloat && self <= kindVec4
+}
+
+func (self kind) isNumeric() bool {
+	return self.isInt() || self.isFloat()
+}
+
+func vecKind(size int, isInt bool) kind {
+	switch size {
+	case 1:
+		if isInt { return kindInt }
+		return kindFloat
+	case 2, 3, 4:
+		if isInt { return kindIVec2 + kind(size - 2) }
+		return kindVec2 + kind(size - 2)
+	default:
+		panic(runtimeErrorf("invalid vector size %d", size))
+	}
+}
+
+// A Kage value. Scalars only use the first component. Integers
+// and booleans are also stored as float64s.
+type value struct {
+	kind kind
+	untyped bool // untyped integer constant, can become a float
+	v [4]float64
+}
+
+func floatValue(f float64) value { return value{ kind: kindFloat, v: [4]float64{f} } }
+func intValue(i int) value { return value{ kind: kindInt, v: [4]float64{float64(i)} } }
+func boolValue(b bool) value {
+	if b { return value{ kind: kindBool, v: [4]float64{1} } }
+	return value{ kind: kindBool }
+}
+
+func (self value) isTrue() bool { return self.v[0] != 0 }
+
+// Returns the i-th component, broadcasting scalars.
+func (self value) at(i int) float64 {
+	if self.kind.size() == 1 { return self.v[0] }
+	return self.v[i]
+}
+
+func (self value) String() string {
+	switch self.kind {
+	case kindBool: return fmt.Sprint(self.isTrue())
+	case kindInt: return fmt.Sprint(int(self.v[0]))
+	case kindFloat: return fmt.Sprint(self.v[0])
+	default:
+		return fmt.Sprintf("%s%v", self.kind, self.v[ : self.kind.size()])
+	}
+}
+
+// Converts the value to the given kind, following assignment rules
+// (with some leniency: ints can always be used as floats).
+func convertTo(val value, target kind) value {
+	if val.kind == target {
+		val.untyped = false
+		return val
+	}
+	if target.isFloat() && val.kind.isInt() && val.kind.size() == target.size() {
+		return value{ kind: target, v: val.v }
+	}
+	if target.isInt() && val.untyped && val.kind.size() == target.size() {
+		return value{ kind: target, v: val.v }
+	}
+	panic(runtimeErrorf("cannot use %s value as %s", val.kind, target))
+}
+
+// Explicit type conversions like float(x) or int(x).
+func castTo(val value, target kind) value {
+	if val.kind.size() != target.size() || val.kind == kindBool || target == kindBool {
+		if val.kind != target {
+			panic(runtimeErrorf("cannot convert %s to %s", val.kind, target))
+		}
+	}
+	out := value{ kind: target, v: val.v }
+	if target.isInt() {
+		for i := 0; i < target.size(); i++ {
+			out.v[i] = math.Trunc(out.v[i])
+		}
+	}
+	return out
+}
+
+// Returns the size of the result of a binary operation between values
+// with the given sizes, broadcasting scalars.
+func broadcastSize(a, b value) int {
+	sa, sb := a.kind.size(), b.kind.size()
+	switch {
+	case sa == sb: return sa
+	case sa == 1: return sb
+	case sb == 1: return sa
+	default:
+		panic(runtimeErrorf("mismatched types %s and %s", a.kind, b.kind))
+	}
+}
+
+func arith(op token.Token, a, b value) value {
+	if a.kind == kindFloat && b.kind == kindFloat { // fast path
+		switch op {
+		case token.ADD: return floatValue(a.v[0] + b.v[0])
+		case token.SUB: return floatValue(a.v[0] - b.v[0])
+		case token.MUL: return floatValue(a.v[0]*b.v[0])
+		case token.QUO: return floatValue(a.v[0]/b.v[0])
+		}
+	}
+	if !a.kind.isNumeric() || !b.kind.isNumeric() {
+		panic(runtimeErrorf("invalid operation %s on %s and %s", op, a.kind, b.kind))
+	}
+	size := broadcastSize(a, b)
+	isInt := a.kind.isInt() && b.kind.isInt()
+	out := value{ kind: vecKind(size, isInt), untyped: a.untyped && b.untyped }
+	for i := 0; i < size; i++ {
+		x, y := a.at(i), b.at(i)
+		switch op {
+		case token.ADD: out.v[i] = x + y
+		case token.SUB: out.v[i] = x - y
+		case token.MUL: out.v[i] = x*y
+		case token.QUO:
+			if isInt {
+				if y == 0 { panic(runtimeErrorf("integer division by zero")) }
+				out.v[i] = math.Trunc(x/y)
+			} else {
+				out.v[i] = x/y
+			}
+		case token.REM:
+			if isInt {
+				if y == 0 { panic(runtimeErrorf("integer division by zero")) }
+				out.v[i] = float64(int64(x) % int64(y))
+			} else {
+				out.v[i] = math.Mod(x, y)
+			}
+		case token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+			if !isInt { panic(runtimeErrorf("operator %s requires integers", op)) }
+			ix, iy := int64(x), int64(y)
+			switch op {
+			case token.AND: out.v[i] = float64(ix & iy)
+			case token.OR : out.v[i] = float64(ix | iy)
+			case token.XOR: out.v[i] = float64(ix ^ iy)
+			case token.SHL: out.v[i] = float64(ix << uint64(iy))
+			case token.SHR: out.v[i] = float64(ix >> uint64(iy))
+			case token.AND_NOT: out.v[i] = float64(ix &^ iy)
+			}
+		default:
+			panic(runtimeErrorf("unsupported operator %s", op))
+		}
+	}
+	return out
+}
+
+func compare(op token.Token, a, b value) value {
+	switch op {
+	case token.EQL, token.NEQ:
+		if a.kind.size() != b.kind.size() || (a.kind == kindBool) != (b.kind == kindBool) {
+			panic(runtimeErrorf("mismatched types %s and %s", a.kind, b.kind))
+		}
+		equal := true
+		for i := 0; i < a.kind.size(); i++ {
+			if a.v[i] != b.v[i] { equal = false }
+		}
+		return boolValue(equal == (op == token.EQL))
+	}
+
+	if a.kind.size() != 1 || b.kind.size() != 1 || !a.kind.isNumeric() || !b.kind.isNumeric() {
+		panic(runtimeErrorf("invalid comparison %s between %s and %s", op, a.kind, b.kind))
+	}
+	x, y := a.v[0], b.v[0]
+	switch op {
+	case token.LSS: return boolValue(x <  y)
+	case token.LEQ: return boolValue(x <= y)
+	case token.GTR: return boolValue(x >  y)
+	case token.GEQ: return boolValue(x >= y)
+	default:
+		panic(runtimeErrorf("unsupported operator %s", op))
+	}
+}
+
+// Applies the given function to each component of a float value.
+func mapFloat(val value, fn func(float64) float64) value {
+	if !val.kind.isFloat() { val = convertTo(val, vecKind(val.kind.size(), false)) }
+	for i := 0; i < val.kind.size(); i++ {
+		val.v[i] = fn(val.v[i])
+	}
+	return val
+}
+
+// Swizzle component indices for selectors like .xy or .rgba.
+func swizzleIndices(selector string) ([]int, bool) {
+	if len(selector) < 1 || len(selector) > 4 { return nil, false }
+	indices := make([]int, len(selector))
+	for _, set := range []string{ "xyzw", "rgba", "stpq" } { // sets can't be mixed
+		for i, char := range selector {
+			indices[i] = strings.IndexRune(set, char)
+			if indices[i] == -1 { break }
+			if i == len(selector) - 1 { return indices, true }
+		}
+	}
+	return nil, false
+}
+
+func swizzle(val value, indices []int) value {
+	size := val.kind.size()
+	if size < 2 { panic(runtimeErrorf("can't swizzle %s value", val.kind)) }
+	out := value{ kind: vecKind(len(indices), val.kind.isInt()) }
+	for i, index := range indices {
+		if index >= size { panic(runtimeErrorf("swizzle out of range for %s", val.kind)) }
+		out.v[i] = val.v[index]
+	}
+	return out
+}
@@ -1,10 +1,18 @@
 package display
 
 import "os"
+import "io"
 import "fmt"
+import "image"
 import "image/color"
+import _ "image/png"
+import _ "image/jpeg"
+import _ "image/gif"
 import "errors"
+import "strings"
+import "strconv"
 import "github.com/hajimehoshi/ebiten/v2"
+import _ "golang.org/x/image/webp"
 
 var errEscClose = errors.New("closed game with ESC")
 
@@ -34,6 +42,11 @@ const (
 var argWindowed bool = false
 var argFullscreen bool = false
 var argMaxFPS bool = false
+var argRecord bool = false
+var argRecordPath string
+var argRecordFrames int // 0 if not set
+var argRecordFPS int // 0 if not set
+var argComparePath string // "" if not set
 var winSizeSet bool = false
 var winDisplayScaling bool = false
 var winResizable bool = false
@@ -44,7 +57,7 @@ var winBackColor = color.RGBA{0, 0, 0, 255}
 
 func init() {
 	var argOpenGL bool = false
-	for _, arg := range os.Args {
+	for i, arg := range os.Args {
 		switch arg {
 		case "--maxfps":
 			if argMaxFPS { warn("repeated --maxfps program flag") }
@@ -69,7 +82,41 @@ func init() {
 				err := os.Setenv("EBITENGINE_GRAPHICS_LIBRARY", "opengl")
 				if err != nil { panic(err) }
 			}
+		case "--compare":
+			if i + 1 >= len(os.Args) { fail("--compare program flag requires a filename") }
+			setCompareFlag(os.Args[i + 1])
 		default:
+			if strings.HasPrefix(arg, "--compare=") {
+				setCompareFlag(strings.TrimPrefix(arg, "--compare="))
+			} else if strings.HasPrefix(arg, "--record=") {
+				if argRecord { warn("repeated --record program flag") }
+				argRecord = true
+				argRecordPath = strings.TrimPrefix(arg, "--record=")
+				if argRecordPath == "" { fail("--record program flag requires a filename") }
+				_, err := recordFormatFor(argRecordPath)
+				if err != nil { fail(err.Error()) }
+			} else if strings.HasPrefix(arg, "--frames=") {
+				frames, err := strconv.Atoi(strings.TrimPrefix(arg, "--frames="))
+				if err != nil || frames < 1 { fail("invalid '" + arg + "' program flag") }
+				argRecordFrames = frames
+			} else if strings.HasPrefix(arg, "--fps=") {
+				fps, err := strconv.Atoi(strings.TrimPrefix(arg, "--fps="))
+				if err != nil || fps < 1 || fps > 240 { fail("invalid '" + arg + "' program flag") }
+				argRecordFPS = fps
+			} else if strings.HasPrefix(arg, "--img") && strings.Contains(arg, "=") {
+				prefix, path, _ := strings.Cut(arg, "=")
+				n, err := strconv.Atoi(strings.TrimPrefix(prefix, "--img"))
+				if err != nil || n < 0 || n > 3 {
+					fail("invalid '" + prefix + "' program flag (expected --img0 to --img3)")
+				}
+				if argShaderImages[n] != nil {
+					warn("repeated " + prefix + " program flag")
+					argShaderImages[n].Dispose()
+				}
+				img, err := loadImageFile(path)
+				if err != nil { fail(err.Error()) }
+				argShaderImages[n] = img
+			}
 			// (allow other program flags or not?)
 			//fail("unexpected '" + arg + "' program flag")
 		}
@@ -84,6 +131,12 @@ func init() {
 	}
 }
 
+func setCompareFlag(path string) {
+	if argComparePath != "" { warn("repeated --compare program flag") }
+	if path == "" { fail("--compare program flag requires a filename") }
+	argComparePath = path
+}
+
 // Sets a window title. Fairly equivalent to [ebiten.SetWindowTitle](),
 // but also stores the title internally in case you pass the --maxfps
 // tag, which will display the FPS on the title bar in addition to
@@ -156,23 +209,86 @@ func SetBackColor(backColor color.RGBA) {
 	winBackColor = backColor
 }
 
-var shaderImage0, shaderImage1, shaderImage2, shaderImage3 *ebiten.Image
+var shaderImageSources [4]any // nil, *ebiten.Image or AutoTexture
+var argShaderImages [4]*ebiten.Image // from --imgN program flags
+var fileShaderImages [4]*ebiten.Image // from LinkShaderImageFile()
 
 // Links a specific image for use with shaders. The given n can
-// only be 0, 1, 2 or 3.
+// only be 0, 1, 2 or 3. See also [LinkShaderAutoTexture]().
 // 
-// By default, two sample textures are already linked for images
-// 0 and 1 (see [ImageSpiderCatDog]() and [ImageWaterfall]()).
-// You can override them with your own or restore them by setting
-// their values back to nil.
+// By default, if the shader uses an image that hasn't been linked,
+// a sample texture is used instead: [ImageSpiderCatDog]() for 0,
+// [ImageWaterfall]() for 1, [TexNoiseColor] for 2 and [TexTriangleColor]
+// for 3. You can override them with your own or restore them by setting
+// their values back to nil. See also [SetShaderImageMapping]().
 func LinkShaderImage(n int, image *ebiten.Image) {
-	switch n {
-	case 0: shaderImage0 = image
-	case 1: shaderImage1 = image
-	case 2: shaderImage2 = image
-	case 3: shaderImage3 = image
+	if n < 0 || n > 3 { panic("n must be between 0 and 3") }
+	if image == nil {
+		shaderImageSources[n] = nil
+	} else {
+		shaderImageSources[n] = image
+	}
+}
+
+// Like [LinkShaderImage](), but for procedural textures like
+// [TexNoiseColor]. Use LinkShaderImage(n, nil) to unlink them.
+func LinkShaderAutoTexture(n int, tex AutoTexture) {
+	if n < 0 || n > 3 { panic("n must be between 0 and 3") }
+	shaderImageSources[n] = tex
+}
+
+// Loads an image from the given file and links it for use with
+// shaders, like [LinkShaderImage](). Supported formats are PNG,
+// JPEG, GIF (first frame only) and WebP.
+//
+// Images can also be linked from the command line with the --img0
+// to --img3 flags, like '--img0=path/to/image.png'. These take
+// precedence over any image linked from code.
+func LinkShaderImageFile(n int, path string) {
+	if n < 0 || n > 3 { panic("n must be between 0 and 3") }
+	img, err := loadImageFile(path)
+	if err != nil { fail(err.Error()) }
+	disposeFileShaderImage(n)
+	fileShaderImages[n] = img
+	shaderImageSources[n] = img
+}
+
+// Disposes the image loaded with LinkShaderImageFile() for the given
+// index, if any. If it was still linked, the index is left unlinked.
+func disposeFileShaderImage(n int) {
+	img := fileShaderImages[n]
+	if img == nil { return }
+	if shaderImageSources[n] == img { shaderImageSources[n] = nil }
+	img.Dispose()
+	fileShaderImages[n] = nil
+}
+
+func loadImageFile(path string) (*ebiten.Image, error) {
+	file, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer file.Close() // ignoring close error
+	return decodeImage(file, path)
+}
+
+func decodeImage(reader io.Reader, name string) (*ebiten.Image, error) {
+	img, _, err := image.Decode(reader)
+	if err != nil { return nil, fmt.Errorf("failed to decode '%s': %w", name, err) }
+	return ebiten.NewImageFromImage(img), nil
+}
+
+// Returns the image linked for the given index, or nil if none.
+// Resizable auto textures are adjusted to the canvas size.
+func getLinkedShaderImage(n int, canvas image.Rectangle) *ebiten.Image {
+	if argShaderImages[n] != nil { return argShaderImages[n] }
+	switch source := shaderImageSources[n].(type) {
+	case nil:
+		return nil
+	case *ebiten.Image:
+		return source
+	case AutoTexture:
+		return getAutoTexture(source, canvas)
 	default:
-		panic("n must be between 0 and 3")
+		panic("unreachable")
 	}
 }
 
@@ -189,11 +305,8 @@ type keyValueUniform struct {
 // uniform hadn't been linked yet, the value will also be
 // set as the starting value.
 func LinkUniformKey(name string, value any, keys ...ebiten.Key) {
-	// detect forbidden overrides
-	if name == "Time" { panic("can't override 'Time' uniform") }
-	if name == "Cursor" { panic("can't override 'Cursor' uniform") }
-	if name == "MouseButtons" { panic("can't override 'MouseButtons' uniform") }
-	
+	assertNotBuiltinUniform(name)
+
 	// see if key already present for the given name
 	for i, _ := range keyValueUniforms {
 		if keyValueUniforms[i].name == name {
@@ -0,0 +1,158 @@
+package display
+
+import "io"
+import "bytes"
+import "image"
+import "hash/crc32"
+import "compress/zlib"
+import "encoding/binary"
+
+// Minimal APNG encoder. The standard library can't write animated
+// PNGs, so we write the chunks ourselves. All frames are encoded as
+// 8-bit RGBA with straight alpha, covering the whole image.
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+type apngEncoder struct {
+	width, height int
+	fps int
+	frames [][]byte // compressed image data for each frame
+}
+
+// Compresses and stores the given frame, which must have the same
+// size as the previous ones.
+func (self *apngEncoder) AddFrame(rgba *image.RGBA) error {
+	bounds := rgba.Bounds()
+	if len(self.frames) == 0 {
+		self.width, self.height = bounds.Dx(), bounds.Dy()
+	} else if bounds.Dx() != self.width || bounds.Dy() != self.height {
+		panic("inconsistent APNG frame sizes")
+	}
+	data, err := compressPNGImageData(rgba)
+	if err != nil { return err }
+	self.frames = append(self.frames, data)
+	return nil
+}
+
+func (self *apngEncoder) Encode(writer io.Writer) error {
+	if len(self.frames) == 0 { panic("can't encode APNG without frames") }
+	_, err := writer.Write(pngSignature)
+	if err != nil { return err }
+
+	var header [13]byte
+	binary.BigEndian.PutUint32(header[0 : 4], uint32(self.width))
+	binary.BigEndian.PutUint32(header[4 : 8], uint32(self.height))
+	header[8] = 8 // bit depth
+	header[9] = 6 // color type (RGBA)
+	err = writePNGChunk(writer, "IHDR", header[:])
+	if err != nil { return err }
+
+	var animControl [8]byte
+	binary.BigEndian.PutUint32(animControl[0 : 4], uint32(len(self.frames)))
+	binary.BigEndian.PutUint32(animControl[4 : 8], 0) // loop forever
+	err = writePNGChunk(writer, "acTL", animControl[:])
+	if err != nil { return err }
+
+	var sequence uint32
+	for i, data := range self.frames {
+		var frameControl [26]byte
+		binary.BigEndian.PutUint32(frameControl[ 0 :  4], sequence)
+		binary.BigEndian.PutUint32(frameControl[ 4 :  8], uint32(self.width))
+		binary.BigEndian.PutUint32(frameControl[ 8 : 12], uint32(self.height))
+		binary.BigEndian.PutUint16(frameControl[20 : 22], 1) // delay numerator
+		binary.BigEndian.PutUint16(frameControl[22 : 24], uint16(self.fps)) // delay denominator
+		// (x/y offsets, dispose op and blend op are all zero)
+		err = writePNGChunk(writer, "fcTL", frameControl[:])
+		if err != nil { return err }
+		sequence += 1
+
+		if i == 0 { // the first frame is also the default image
+			err = writePNGChunk(writer, "IDAT", data)
+		} else {
+			frameData := make([]byte, 4 + len(data))
+			binary.BigEndian.PutUint32(frameData[0 : 4], sequence)
+			copy(frameData[4 : ], data)
+			err = writePNGChunk(writer, "fdAT", frameData)
+		}
+		if err != nil { return err }
+		if i != 0 { sequence += 1 }
+	}
+
+	return writePNGChunk(writer, "IEND", nil)
+}
+
+func writePNGChunk(writer io.Writer, chunkType string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[0 : 4], uint32(len(data)))
+	copy(header[4 : 8], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4 : 8])
+	crc.Write(data)
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	_, err := writer.Write(header[:])
+	if err != nil { return err }
+	_, err = writer.Write(data)
+	if err != nil { return err }
+	_, err = writer.Write(footer[:])
+	return err
+}
+
+// Filters the image rows with the Paeth filter and compresses them.
+// Colors are converted from premultiplied to straight alpha.
+func compressPNGImageData(rgba *image.RGBA) ([]byte, error) {
+	bounds := rgba.Bounds()
+	rowLen := bounds.Dx()*4
+	prevRow := make([]byte, rowLen)
+	currRow := make([]byte, rowLen)
+	filtered := make([]byte, 1 + rowLen)
+	filtered[0] = 4 // Paeth filter
+
+	var buffer bytes.Buffer
+	compressor := zlib.NewWriter(&buffer)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		offset := rgba.PixOffset(bounds.Min.X, y)
+		copy(currRow, rgba.Pix[offset : offset + rowLen])
+		for i := 0; i < rowLen; i += 4 {
+			alpha := uint32(currRow[i + 3])
+			if alpha == 0 || alpha == 255 { continue }
+			currRow[i + 0] = unpremultiply(currRow[i + 0], alpha)
+			currRow[i + 1] = unpremultiply(currRow[i + 1], alpha)
+			currRow[i + 2] = unpremultiply(currRow[i + 2], alpha)
+		}
+		for i := 0; i < rowLen; i++ {
+			var left, upLeft byte
+			if i >= 4 { left, upLeft = currRow[i - 4], prevRow[i - 4] }
+			filtered[1 + i] = currRow[i] - paethPredictor(left, prevRow[i], upLeft)
+		}
+		_, err := compressor.Write(filtered)
+		if err != nil { return nil, err }
+		prevRow, currRow = currRow, prevRow
+	}
+	err := compressor.Close()
+	if err != nil { return nil, err }
+	return buffer.Bytes(), nil
+}
+
+// Converts a premultiplied color channel to straight alpha. Channels
+// greater than alpha are invalid premultiplied colors, but shaders
+// can still produce them, so the result is clamped.
+func unpremultiply(channel uint8, alpha uint32) uint8 {
+	straight := (uint32(channel)*255 + alpha/2)/alpha
+	if straight > 255 { return 255 }
+	return uint8(straight)
+}
+
+func paethPredictor(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p - int(a)), absInt(p - int(b)), absInt(p - int(c))
+	if pa <= pb && pa <= pc { return a }
+	if pb <= pc { return b }
+	return c
+}
+
+func absInt(x int) int {
+	if x < 0 { return -x }
+	return x
+}
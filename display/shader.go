@@ -4,7 +4,6 @@ import "os"
 import "fmt"
 import "math"
 import "sort"
-import "time"
 import "image"
 import "io/fs"
 import "strings"
@@ -24,12 +23,61 @@ import "github.com/hajimehoshi/ebiten/v2/inpututil"
 //  - Multiple uniforms are given by default. This includes
 //    'Time float', 'Cursor vec2' (in [0, 1] normalized
 //    coordinates), 'MouseButtons int' (0b00 if none, 0b10
-//    if left, 0b01 if right, 0b11 if both).
-//  - Sample textures are linked to Images[0] and Images[1] if
+//    if left, 0b01 if right, 0b11 if both). Additionally, if
+//    the shader declares them, 'Tick' and 'Frame' (int or float,
+//    update and draw counts), 'DeltaTime float' (seconds since
+//    the previous frame), 'LastClickPos vec2' (normalized, like
+//    Cursor), 'BackColor vec4' (see [SetBackColor]()) and
+//    'Resolution vec2' (canvas size in pixels) are also set.
+//  - Uniforms can be annotated with comment macros to get on-screen
+//    controls, like 'var Radius float // @slider 0..100 default=40'
+//    or 'var Tint vec4 // @color'. Press Tab to toggle the panel.
+//    Sliders can also be linked from Go with [LinkUniformSlider]().
+//  - Sample textures are linked to Images[0] to Images[3] if
 //    image usage is detected. You can also [LinkShaderImage]()
-//    on your own.
+//    on your own, or [LinkShaderAutoTexture]() for procedural textures
+//    like [TexNoiseColor], and choose how each image is mapped with [SetShaderImageMapping]().
+//    Image files can also be dropped on the window to load them on
+//    Images[0], or on Images[N] while holding the digit key N.
+//
+// The Time uniform can be paused and resumed with Space, stepped
+// frame by frame with period and comma, and sped up or slowed down
+// with equal and minus. Once any of these is used, the current time
+// and a scrub bar are shown at the bottom of the canvas.
+//
+// With [LinkFeedbackImage](), the previous frame's output is given
+// to the shader as an image, which can be reset with Backspace.
+//
+// Press E to export a screenshot of the canvas as a PNG file, or R
+// to start and stop recording an animation. See [SetScreenshotOptions]()
+// and [SetRecordOptions]() for additional configuration.
+//
+// Hold I to inspect the pixel under the cursor: a magnified loupe is
+// shown along with the pixel coordinates (in pixels and normalized),
+// the source coordinates and the raw shader output color, both with
+// premultiplied and straight alpha.
+//
+// With the '--compare=other.kage' flag, the shader is displayed side
+// by side with the given one. See [CompareShaders]() for details.
+// For effects that require multiple passes, see [Pipeline]().
+//
+// If the shader is loaded from a file (either explicitly or through
+// the working directory search), the file will be watched and the
+// shader will be hot-reloaded whenever it changes on disk. If the
+// new version fails to compile, the previous shader will keep
+// running and the error will be displayed on screen. Compilation
+// errors are also printed with some source context (see [ShaderError]).
+//
+// Uniform values are converted to the types declared by the shader
+// when possible (e.g. int to float, or []float64 to []float32), and
+// warnings are printed for values that can't be converted, uniforms
+// that are set but not declared and declared uniforms never set.
+//
+// Shared code can be included from other files with directives like
+// '//kage-desk:include "common/color.kage"'. See [SetIncludeFS]().
 func Shader(args ...any) {
 	var programBytes []byte
+	var programPath string
 
 	//var updateFunc func(*ebiten.DrawTrianglesShaderOptions)
 	for _, arg := range args {
@@ -41,6 +89,7 @@ func Shader(args ...any) {
 			bytes, err := os.ReadFile(typedArg)
 			if err != nil { fail(err.Error()) }
 			programBytes = bytes
+			programPath = typedArg
 			// _ = preprocess(programBytes)
 		case []byte:
 			if len(typedArg) == 0 {
@@ -68,6 +117,7 @@ func Shader(args ...any) {
 				bytes, err := os.ReadFile(path)
 				if err != nil { return err }
 				programBytes = bytes
+				programPath = path
 				// _ = preprocess(programBytes)
 			}
 			return nil
@@ -78,22 +128,48 @@ func Shader(args ...any) {
 		fail("no shader could be found in the working directory")
 	}
 
-	shader, err := ebiten.NewShader(programBytes)
-	if err != nil {
-		// TODO: improve debug info, show context, etc.
-		fmt.Printf("Failed to load shader:\n%s\n\n", err.Error())
-		os.Exit(1)
+	displayer := newShaderDisplayer()
+	if argComparePath != "" {
+		bytes, err := os.ReadFile(argComparePath)
+		if err != nil { fail(err.Error()) }
+		if len(bytes) == 0 { fail("--compare shader file '" + argComparePath + "' is empty") }
+		displayer.setComparison(bytes, argComparePath)
 	}
+	runShader(displayer, programBytes, programPath)
+}
 
-	displayer := &shaderDisplayer{
-		shader: shader,
-		scale: 1.0,
-		startTime: time.Now(),
-		usingImage0: containsOutsideComment(programBytes, []rune("imageSrc0")),
-		usingImage1: containsOutsideComment(programBytes, []rune("imageSrc1")),
+func newShaderDisplayer() *shaderDisplayer {
+	return &shaderDisplayer{ scale: 1.0, clock: newTimeControl() }
+}
+
+// Sets the main program on the displayer and runs it. The path may
+// be empty if the program was not loaded from a file. Comparisons
+// and pipelines must be set up before calling this.
+func runShader(displayer *shaderDisplayer, programBytes []byte, programPath string) {
+	shader, source, err := compileShader(programBytes, programPath)
+	if err != nil {
+		// keep the window open so the error can be seen on screen
+		// (and fixed through hot-reloading, if loaded from a file)
+		displayer.storeCompileErr("load", "shader", err, false)
+	}
+	if source != nil { programBytes = source.program }
+	displayer.setProgram(shader, programBytes)
+	if feedbackIndex != -1 {
+		displayer.feedback = newFeedbackBuffer(feedbackIndex, feedbackInitial)
+	}
+	if programPath != "" {
+		displayer.watcher = newShaderWatcher(programPath)
+		if source != nil { displayer.watcher.SetIncludes(source.includes) }
+	}
+	if argRecord {
+		filename, frames, fps := getRecordOptions()
+		recorder, err := newFrameRecorder(filename, frames, fps, 0)
+		if err != nil { fail(err.Error()) }
+		recorder.exitOnEnd = true
+		displayer.recorder = recorder
 	}
 	err = ebiten.RunGame(displayer)
-	if err != nil && err != errEscClose {
+	if err != nil && err != errEscClose && err != errRecordingDone {
 		fail(err.Error())
 	}
 }
@@ -104,9 +180,77 @@ type shaderDisplayer struct {
 	options ebiten.DrawTrianglesShaderOptions
 	scale float64
 	fsKeyPressed bool // fullscreen key
-	usingImage0 bool
-	usingImage1 bool
-	startTime time.Time
+	usingImages [4]bool // whether imageSrcN is used in the program
+	imageAdapters [4]*ebiten.Image // see shader_images.go
+	fixedImages *[4]*ebiten.Image // used instead of linked images if not nil (headless)
+	droppedImages [4]*ebiten.Image // see shader_drop.go
+	clock timeControl
+	screenshotRequested bool
+	screenshotImage *ebiten.Image // see shader_screenshot.go
+	recorder *frameRecorder // nil if not recording
+	recordImage *ebiten.Image
+	inspectImage *ebiten.Image // see shader_inspect.go
+	srcBounds image.Rectangle // source region on the last shader draw
+	watcher *shaderWatcher // nil if the shader wasn't loaded from a file
+	programBytes []byte // source of the current program
+	compare *shaderComparison // nil if not comparing, see shader_compare.go
+	pipeline *shaderPipeline // nil if not using multiple passes, see shader_pipeline.go
+	feedback *feedbackBuffer // nil if no feedback image is linked, see shader_feedback.go
+	compileErr string // non-empty if the last compilation failed
+	compileErrName string // name of the program that failed to compile
+	autoUniforms *autoUniformSet
+	canvasBounds image.Rectangle // canvas bounds on the last draw
+	declaredUniforms map[string]string // uniform name to type name
+	uniformWarnings map[string]bool // see checkUniforms()
+	builtins builtinState
+}
+
+// Sets the current shader (which may be nil if the initial
+// compilation failed) and updates the program properties
+// that depend on the shader source. When comparing shaders,
+// the properties of both programs are combined. Pipeline passes
+// contribute their uniforms, but track their own image usage.
+func (self *shaderDisplayer) setProgram(shader *ebiten.Shader, programBytes []byte) {
+	self.shader = shader
+	self.programBytes = programBytes
+	programs := [][]byte{ programBytes }
+	if self.compare != nil {
+		programs = append(programs, self.compare.programBytes)
+	}
+	uniformPrograms := programs
+	if self.pipeline != nil {
+		for _, pass := range self.pipeline.passes {
+			uniformPrograms = append(uniformPrograms, pass.programBytes)
+		}
+	}
+
+	for n := 0; n < 4; n++ {
+		self.usingImages[n] = false
+		for _, program := range programs {
+			if containsOutsideComment(program, []rune(fmt.Sprintf("imageSrc%d", n))) {
+				self.usingImages[n] = true
+			}
+		}
+	}
+	self.uniformWarnings = nil // (warn again on reloads)
+	self.declaredUniforms = make(map[string]string)
+	for _, program := range uniformPrograms {
+		for _, decl := range parseUniformDecls(program) {
+			// on conflicting declarations, the main program wins
+			if _, found := self.declaredUniforms[decl.name]; found { continue }
+			self.declaredUniforms[decl.name] = decl.typeName
+		}
+	}
+
+	// comment macros may change between reloads, but we want
+	// to preserve the current values when possible. Uniforms
+	// linked from Go take precedence over comment macros.
+	autoUniforms := newAutoUniformSet().Add(linkedAutoUniforms...)
+	for _, program := range uniformPrograms {
+		autoUniforms.Add(preprocess(program).uniforms...)
+	}
+	autoUniforms.Inherit(self.autoUniforms)
+	self.autoUniforms = autoUniforms
 }
 
 func (self *shaderDisplayer) Layout(w, h int) (int, int) {
@@ -145,6 +289,40 @@ func (self *shaderDisplayer) Update() error {
 		self.fsKeyPressed = fsKeyPressed
 	}
 
+	// screenshots
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		self.screenshotRequested = true
+	}
+
+	// recordings
+	if self.recorder != nil && self.recorder.Done() {
+		exit := self.recorder.exitOnEnd
+		self.finishRecording()
+		if exit { return errRecordingDone }
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		self.toggleRecording()
+	}
+
+	// hot-reload the shader if its file changed
+	if self.watcher != nil {
+		self.hotReload()
+	}
+	if self.compare != nil && self.compare.watcher != nil {
+		self.hotReloadComparison()
+	}
+	if self.pipeline != nil {
+		self.hotReloadPasses()
+	}
+
+	// reset the feedback image if requested
+	if self.feedback != nil && inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
+		self.feedback.resetRequested = true
+	}
+
+	// load dropped image files
+	self.handleDroppedFiles()
+
 	// update key detection
 	for _, kvu := range keyValueUniforms {
 		for _, key := range kvu.keys {
@@ -158,24 +336,30 @@ func (self *shaderDisplayer) Update() error {
 		}
 	}
 
+	// update time controls, built-in and auto uniforms, and the uniforms panel
+	self.clock.Update(self.canvasBounds)
+	self.builtins.Update(self.canvasBounds)
+	self.autoUniforms.Update(self.canvasBounds)
+	if self.compare != nil {
+		self.updateComparison()
+	}
+
 	//if self.updateFunc != nil { self.updateFunc(&self.options) }
 	return nil
 }
 
 func (self *shaderDisplayer) Draw(screen *ebiten.Image) {
-	screen.Fill(winBackColor)
-
 	bounds := screen.Bounds()
+	self.canvasBounds = bounds
 	width, height := float64(bounds.Dx()), float64(bounds.Dy())
-	var x, y float32 = 0.0, 0.0
-	sxl, sxr := x, x + float32(width)
-	syt, syb := y, y + float32(height)
-	PositionRectVertices(&self.vertices, sxl, sxr, syt, syb, sxl, sxr, syt, syb)
-	indices := []uint16{0, 1, 2, 1, 2, 3}
-	
+
 	// uniforms
 	if uniformValues == nil { uniformValues = make(map[string]any, 3) }
-	uniformValues["Time"] = float32(time.Now().Sub(self.startTime).Seconds())
+	if self.recorder != nil && !self.recorder.Done() {
+		uniformValues["Time"] = float32(self.recorder.Time())
+	} else {
+		uniformValues["Time"] = float32(self.clock.Advance())
+	}
 	cx, cy := ebiten.CursorPosition()
 	
 	// horzMargin, vertMargin := self.hackyGetMargins(screen)
@@ -188,35 +372,96 @@ func (self *shaderDisplayer) Draw(screen *ebiten.Image) {
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft ) { mouseButtons += 0b10 }
 	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) { mouseButtons += 0b01 }
 	uniformValues["MouseButtons"] = mouseButtons
+	self.builtins.Set(uniformValues, self.declaredUniforms, bounds)
+	self.autoUniforms.Set(uniformValues)
+	if self.feedback != nil {
+		self.feedback.Request(uniformValues["Time"].(float32), self.clock.paused)
+	}
 	
 	// link uniforms to shader options
 	if self.options.Uniforms == nil {
 		self.options.Uniforms = make(map[string]any, len(uniformValues))
 	}
+	for key, _ := range self.options.Uniforms {
+		_, found := uniformValues[key]
+		if !found { delete(self.options.Uniforms, key) }
+	}
 	for key, value := range uniformValues {
 		self.options.Uniforms[key] = value
 	}
+	self.checkUniforms()
 
-	// source image linking
-	var srcBounds image.Rectangle
-	if self.usingImage0 || shaderImage0 != nil {
-		if shaderImage0 != nil {
-			self.options.Images[0] = shaderImage0
-		} else {
-			self.options.Images[0] = ImageSpiderCatDog()
-		}
-		srcBounds = self.options.Images[0].Bounds()
+	// draw shader and overlay
+	var screenshot *ebiten.Image // shader output to export, if requested
+	if self.recorder != nil && !self.recorder.Done() {
+		self.drawRecordedFrame(screen)
+		if self.screenshotRequested { screenshot = self.recordImage }
+	} else if self.screenshotRequested {
+		screenshot = self.drawScreenshotFrame(screen)
+	} else if self.isInspecting() {
+		self.drawInspectedFrame(screen)
+	} else {
+		self.drawShader(screen, bounds)
+	}
+	self.drawComparisonInfo(screen)
+	self.drawOverlay(screen)
+	self.drawRecordingInfo(screen)
+	self.drawInspector(screen)
+
+	// export screenshot if requested
+	if self.screenshotRequested {
+		self.screenshotRequested = false
+		self.exportScreenshot(screenshot, bounds)
 	}
-	if self.usingImage1 || shaderImage1 != nil {
-		self.options.Images[1] = ImageWaterfall()
-		if srcBounds.Empty() { srcBounds = self.options.Images[1].Bounds() }
+}
+
+// Draws the shader to the given target, which may have a
+// different size than the canvas.
+func (self *shaderDisplayer) drawShader(target *ebiten.Image, canvas image.Rectangle) {
+	target.Fill(winBackColor)
+	self.drawShaderOutput(target, canvas)
+}
+
+// Like drawShader, but without filling the background first.
+func (self *shaderDisplayer) drawShaderOutput(target *ebiten.Image, canvas image.Rectangle) {
+	if self.feedback != nil {
+		self.feedback.Prepare(canvas)
 	}
-	if shaderImage2 != nil {
-		self.options.Images[2] = shaderImage2
-		if srcBounds.Empty() { srcBounds = self.options.Images[2].Bounds() }
+	if self.pipeline != nil {
+		self.drawPasses(canvas)
 	}
+	if self.compare != nil {
+		self.drawComparison(target, canvas)
+	} else {
+		self.drawMainOutput(target, canvas)
+	}
+}
+
+// Draws the main shader to the target, through the feedback
+// buffer if there's one.
+func (self *shaderDisplayer) drawMainOutput(target *ebiten.Image, canvas image.Rectangle) {
+	if self.feedback != nil {
+		self.drawFeedback(target, canvas)
+	} else {
+		self.drawProgramOutput(self.shader, target, canvas)
+	}
+}
+
+// Draws the given shader to the target. The shader may be nil,
+// in which case only the source images are linked.
+func (self *shaderDisplayer) drawProgramOutput(shader *ebiten.Shader, target *ebiten.Image, canvas image.Rectangle) {
+	self.srcBounds = self.linkSourceImages(canvas)
+	self.drawProgramRegion(shader, target, self.srcBounds)
+}
+
+// Draws the given shader to the whole target, mapping the given
+// source region to it. Source images must already be linked.
+func (self *shaderDisplayer) drawProgramRegion(shader *ebiten.Shader, target *ebiten.Image, srcBounds image.Rectangle) {
+	dxl, dxr, dyt, dyb := RectToF32(target.Bounds())
+	PositionRectVertices(&self.vertices, dxl, dxr, dyt, dyb, dxl, dxr, dyt, dyb)
+	indices := []uint16{0, 1, 2, 1, 2, 3}
 
-	if srcBounds.Empty() { srcBounds = bounds }
+	// source region
 	self.vertices[0].SrcX = float32(srcBounds.Min.X) // top-left
 	self.vertices[0].SrcY = float32(srcBounds.Min.Y) // top-left
 	self.vertices[1].SrcX = float32(srcBounds.Max.X) // top-right
@@ -245,7 +490,15 @@ func (self *shaderDisplayer) Draw(screen *ebiten.Image) {
 	self.vertices[3].ColorA = 1.0 // bottom-right (yellow)
 
 	// actual shader draw call
-	screen.DrawTrianglesShader(self.vertices[0 : 4], indices, self.shader, &self.options)
+	if shader != nil {
+		target.DrawTrianglesShader(self.vertices[0 : 4], indices, shader, &self.options)
+	}
+}
+
+// Draws the uniform infos, the uniforms panel and the compilation
+// errors, if any.
+func (self *shaderDisplayer) drawOverlay(screen *ebiten.Image) {
+	bounds := screen.Bounds()
 
 	// handle uniform infos
 	for key, _ := range extraUniformInfos {
@@ -269,6 +522,24 @@ func (self *shaderDisplayer) Draw(screen *ebiten.Image) {
 		ebitenutil.DebugPrintAt(screen, details, bounds.Min.X + 1, bounds.Min.Y + i*13)
 	}
 	extraUniformInfoOrders = extraUniformInfoOrders[ : 0]
+	self.autoUniforms.DrawUI(screen)
+	self.clock.Draw(screen)
+
+	// show compilation errors, if any
+	if self.compileErr != "" {
+		self.drawCompileErr(screen)
+	}
+}
+
+// Returns the given image cleared, or a new one if its size
+// doesn't match.
+func resetImage(img *ebiten.Image, size image.Point) *ebiten.Image {
+	if img == nil || img.Bounds().Size() != size {
+		if img != nil { img.Dispose() }
+		return ebiten.NewImage(size.X, size.Y)
+	}
+	img.Clear()
+	return img
 }
 
 func minf64(a, b float64) float64 {
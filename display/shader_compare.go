@@ -0,0 +1,218 @@
+package display
+
+import "fmt"
+import "math"
+import "image"
+import "path/filepath"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/inpututil"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+const compareGrabDistance = 6 // max distance to the divider to start dragging it
+
+// Highlights the pixels that differ between images 0 and 1 in red,
+// brighter for bigger differences, and dims the rest.
+var compareDiffProgram = []byte(`//kage:unit pixels
+package main
+
+func Fragment(targetCoords vec4, srcPos vec2, color vec4) vec4 {
+	a := imageSrc0UnsafeAt(srcPos)
+	b := imageSrc1UnsafeAt(srcPos)
+	delta := abs(a - b)
+	maxDelta := max(max(delta.r, delta.g), max(delta.b, delta.a))
+	if maxDelta > 0 {
+		return vec4(0.5 + maxDelta*0.5, 0, 0, 1)
+	}
+	luma := dot(a.rgb, vec3(0.3, 0.6, 0.1))*0.25
+	return vec4(luma, luma, luma, 1)
+}
+`)
+
+// Like [Shader](), but displays two shaders side by side, so their
+// outputs can be compared. Both shaders receive the same uniforms,
+// images and Time. The canvas shows shader a on the left and shader
+// b on the right of a vertical divider, which can be dragged with
+// the mouse. Press X to swap to a difference view, where pixels that
+// differ are highlighted in red, and the number of differing pixels
+// is shown. Comment macros from both shaders are combined.
+//
+// A file can also be compared against the shader loaded by [Shader]()
+// with the '--compare' flag, like '--compare=other.kage'. In that
+// case, both files are hot-reloaded.
+func CompareShaders(a, b []byte) {
+	if len(a) == 0 || len(b) == 0 {
+		fail("received empty []byte shader on display.CompareShaders()")
+	}
+	if argComparePath != "" {
+		warn("--compare program flag ignored on display.CompareShaders()")
+	}
+	displayer := newShaderDisplayer()
+	displayer.setComparison(b, "")
+	runShader(displayer, a, "")
+}
+
+type shaderComparison struct {
+	shader *ebiten.Shader // may be nil if the compilation failed
+	programBytes []byte
+	watcher *shaderWatcher // nil if the shader wasn't loaded from a file
+	divider float64 // normalized x position of the divider
+	dragging bool
+	diffView bool
+	diffCount int // differing pixels on the last diff view draw
+	diffShader *ebiten.Shader
+	imageA *ebiten.Image
+	imageB *ebiten.Image
+	diffImage *ebiten.Image
+	diffPixels []byte
+}
+
+// Sets up the comparison against the given program. Must be
+// called before setProgram() for the main shader.
+func (self *shaderDisplayer) setComparison(programBytes []byte, path string) {
+	self.compare = &shaderComparison{ programBytes: programBytes, divider: 0.5 }
+	shader, source, err := compileShader(programBytes, path)
+	if err != nil {
+		self.storeCompileErr("load", "shader B", err, false)
+	}
+	self.compare.shader = shader
+	if source != nil { self.compare.programBytes = source.program }
+	if path != "" {
+		self.compare.watcher = newShaderWatcher(path)
+		if source != nil { self.compare.watcher.SetIncludes(source.includes) }
+	}
+}
+
+// Like hotReload, but for the shader we are comparing against.
+func (self *shaderDisplayer) hotReloadComparison() {
+	cmp := self.compare
+	self.reloadProgram(cmp.watcher, "shader B", cmp.shader, func(shader *ebiten.Shader, programBytes []byte) {
+		cmp.shader = shader
+		cmp.programBytes = programBytes
+		self.setProgram(self.shader, self.programBytes)
+	})
+}
+
+// Handles the diff view key and the divider dragging.
+func (self *shaderDisplayer) updateComparison() {
+	cmp := self.compare
+	if inpututil.IsKeyJustPressed(ebiten.KeyX) {
+		cmp.diffView = !cmp.diffView
+		cmp.dragging = false
+	}
+	canvas := self.canvasBounds
+	if cmp.diffView || canvas.Empty() || !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		cmp.dragging = false
+		return
+	}
+
+	x, y := ebiten.CursorPosition()
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		dist := x - cmp.dividerX(canvas)
+		cmp.dragging = dist >= -compareGrabDistance && dist <= compareGrabDistance && !self.overControls(x, y)
+	}
+	if cmp.dragging {
+		cmp.divider = clampUnit(float64(x - canvas.Min.X)/float64(canvas.Dx()))
+	}
+}
+
+// Returns whether the given position is over the uniforms panel
+// or the scrub bar, which take precedence over the divider.
+func (self *shaderDisplayer) overControls(x, y int) bool {
+	pt := image.Pt(x, y)
+	if self.autoUniforms.hasWidgets() && pt.In(self.autoUniforms.panelRect(self.canvasBounds)) {
+		return true
+	}
+	return self.clock.used && pt.In(self.clock.scrubBarRect(self.canvasBounds).Inset(-4))
+}
+
+func (self *shaderComparison) dividerX(bounds image.Rectangle) int {
+	return bounds.Min.X + int(math.Round(self.divider*float64(bounds.Dx())))
+}
+
+// Draws both shaders to the target, split by the divider, or
+// their difference if the diff view is active.
+func (self *shaderDisplayer) drawComparison(target *ebiten.Image, canvas image.Rectangle) {
+	cmp := self.compare
+	bounds := target.Bounds()
+	cmp.imageA = resetImage(cmp.imageA, bounds.Size())
+	cmp.imageB = resetImage(cmp.imageB, bounds.Size())
+	self.drawMainOutput(cmp.imageA, canvas)
+	self.drawProgramOutput(cmp.shader, cmp.imageB, canvas)
+
+	var opts ebiten.DrawImageOptions
+	opts.GeoM.Translate(float64(bounds.Min.X), float64(bounds.Min.Y))
+	if cmp.diffView {
+		cmp.drawDiff()
+		target.DrawImage(cmp.diffImage, &opts)
+		return
+	}
+
+	split := cmp.dividerX(bounds) - bounds.Min.X
+	target.DrawImage(cmp.imageA.SubImage(image.Rect(0, 0, split, bounds.Dy())).(*ebiten.Image), &opts)
+	opts.GeoM.Translate(float64(split), 0)
+	target.DrawImage(cmp.imageB.SubImage(image.Rect(split, 0, bounds.Dx(), bounds.Dy())).(*ebiten.Image), &opts)
+}
+
+// Draws the difference between imageA and imageB to diffImage
+// and counts the differing pixels.
+func (self *shaderComparison) drawDiff() {
+	if self.diffShader == nil {
+		shader, err := ebiten.NewShader(compareDiffProgram)
+		if err != nil { panic(err) }
+		self.diffShader = shader
+	}
+
+	size := self.imageA.Bounds().Size()
+	self.diffImage = resetImage(self.diffImage, size)
+	var opts ebiten.DrawRectShaderOptions
+	opts.Images[0] = self.imageA
+	opts.Images[1] = self.imageB
+	self.diffImage.DrawRectShader(size.X, size.Y, self.diffShader, &opts)
+
+	// differing pixels are the only ones with red != green
+	if len(self.diffPixels) != size.X*size.Y*4 {
+		self.diffPixels = make([]byte, size.X*size.Y*4)
+	}
+	self.diffImage.ReadPixels(self.diffPixels)
+	self.diffCount = 0
+	for i := 0; i < len(self.diffPixels); i += 4 {
+		if self.diffPixels[i] != self.diffPixels[i + 1] { self.diffCount += 1 }
+	}
+}
+
+// Draws the divider and the shader labels, or the diff view info.
+func (self *shaderDisplayer) drawComparisonInfo(screen *ebiten.Image) {
+	cmp := self.compare
+	if cmp == nil { return }
+	bounds := screen.Bounds()
+	const labelY = 24 // (leave some space for uniform infos)
+
+	if cmp.diffView {
+		info := "[X] diff view | identical"
+		if cmp.diffCount > 0 {
+			info = fmt.Sprintf("[X] diff view | %d pixels differ", cmp.diffCount)
+		}
+		x := bounds.Min.X + (bounds.Dx() - len(info)*6)/2
+		fillRect(screen, image.Rect(x - 4, bounds.Min.Y + labelY, x + len(info)*6 + 4, bounds.Min.Y + labelY + 16), panelBackColor)
+		ebitenutil.DebugPrintAt(screen, info, x, bounds.Min.Y + labelY)
+		return
+	}
+
+	x := cmp.dividerX(bounds)
+	vector.StrokeLine(screen, float32(x), float32(bounds.Min.Y), float32(x), float32(bounds.Max.Y), 2, panelBackColor, false)
+	vector.StrokeLine(screen, float32(x), float32(bounds.Min.Y), float32(x), float32(bounds.Max.Y), 1, panelHandleColor, false)
+	midY := bounds.Min.Y + bounds.Dy()/2
+	fillRect(screen, image.Rect(x - 3, midY - 12, x + 3, midY + 12), panelHandleColor)
+
+	labelA, labelB := "A", "B"
+	if self.watcher != nil { labelA += ": " + filepath.Base(self.watcher.path) }
+	if cmp.watcher != nil { labelB += ": " + filepath.Base(cmp.watcher.path) }
+	labelB += " [X] diff"
+	leftX := x - 8 - len(labelA)*6
+	fillRect(screen, image.Rect(leftX - 4, bounds.Min.Y + labelY, x - 4, bounds.Min.Y + labelY + 16), panelBackColor)
+	ebitenutil.DebugPrintAt(screen, labelA, leftX, bounds.Min.Y + labelY)
+	fillRect(screen, image.Rect(x + 4, bounds.Min.Y + labelY, x + 12 + len(labelB)*6, bounds.Min.Y + labelY + 16), panelBackColor)
+	ebitenutil.DebugPrintAt(screen, labelB, x + 8, bounds.Min.Y + labelY)
+}
@@ -0,0 +1,67 @@
+package display
+
+import "fmt"
+import "io/fs"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Loads image files dropped on the window into the shader source
+// images. Files go to Images[0] by default, or to the slot of the
+// digit key held while dropping (0 to 3). If multiple files are
+// dropped at once, they go to consecutive slots.
+func (self *shaderDisplayer) handleDroppedFiles() {
+	dropped := ebiten.DroppedFiles()
+	if dropped == nil { return }
+	entries, err := fs.ReadDir(dropped, ".")
+	if err != nil {
+		warn("failed to read dropped files: " + err.Error())
+		return
+	}
+
+	slot := heldImageSlotKey()
+	for _, entry := range entries {
+		if entry.IsDir() { continue }
+		if slot > 3 {
+			warn("too many files dropped, ignoring '" + entry.Name() + "'")
+			continue
+		}
+
+		file, err := dropped.Open(entry.Name())
+		if err != nil {
+			warn(err.Error())
+			continue
+		}
+		img, err := decodeImage(file, entry.Name())
+		file.Close() // ignoring close error
+		if err != nil {
+			warn(err.Error())
+			continue
+		}
+
+		// replace previous images, disposing the ones we loaded ourselves
+		// (images linked with LinkShaderImage() belong to the user)
+		if argShaderImages[slot] != nil {
+			argShaderImages[slot].Dispose()
+			argShaderImages[slot] = nil
+		}
+		if self.droppedImages[slot] != nil {
+			self.droppedImages[slot].Dispose()
+		}
+		disposeFileShaderImage(slot)
+		self.droppedImages[slot] = img
+		LinkShaderImage(slot, img)
+		bounds := img.Bounds()
+		fmt.Printf("Loaded '%s' (%dx%d) into Images[%d]\n", entry.Name(), bounds.Dx(), bounds.Dy(), slot)
+		slot += 1
+	}
+}
+
+// Returns the image slot selected with the digit keys, or 0 if none.
+func heldImageSlotKey() int {
+	digits  := [4]ebiten.Key{ebiten.KeyDigit0, ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3}
+	numpads := [4]ebiten.Key{ebiten.KeyNumpad0, ebiten.KeyNumpad1, ebiten.KeyNumpad2, ebiten.KeyNumpad3}
+	for n := 0; n < 4; n++ {
+		if ebiten.IsKeyPressed(digits[n]) || ebiten.IsKeyPressed(numpads[n]) { return n }
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package display
+
+import "fmt"
+import "errors"
+import "regexp"
+import "strconv"
+import "strings"
+import "go/scanner"
+import "image/color"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+// Number of source lines shown before and after the offending line
+// on [ShaderError] snippets.
+const shaderErrorContextLines = 2
+
+// A shader compilation error, with the position of the error and
+// the relevant source lines. Returned as part of a [ShaderErrorList]
+// by [CompileShader]().
+type ShaderError struct {
+	File string // empty if the shader was not loaded from a file
+	Line int // 1-based, or 0 if the error has no position
+	Column int // 1-based, or 0 if the error has no position
+	Message string
+	Snippet string // offending source lines with a caret, empty if Line is 0
+}
+
+// Returns the error formatted as "file:line:column: message".
+func (self *ShaderError) Error() string {
+	var prefix string
+	if self.File != "" { prefix = self.File + ":" }
+	if self.Line > 0 {
+		prefix += strconv.Itoa(self.Line) + ":" + strconv.Itoa(self.Column) + ":"
+	}
+	if prefix == "" { return self.Message }
+	return prefix + " " + self.Message
+}
+
+// Returns the error message followed by the source snippet, if any.
+func (self *ShaderError) Verbose() string {
+	if self.Snippet == "" { return self.Error() }
+	return self.Error() + "\n" + self.Snippet
+}
+
+// A list of shader compilation errors, as returned by [CompileShader]().
+type ShaderErrorList []*ShaderError
+
+// Returns all the errors, one per line.
+func (self ShaderErrorList) Error() string {
+	var strs []string
+	for _, err := range self {
+		strs = append(strs, err.Error())
+	}
+	return strings.Join(strs, "\n")
+}
+
+// Returns all the errors with their source snippets.
+func (self ShaderErrorList) Verbose() string {
+	var strs []string
+	for _, err := range self {
+		strs = append(strs, err.Verbose())
+	}
+	return strings.Join(strs, "\n\n")
+}
+
+// Equivalent to [ebiten.NewShader](), but compilation errors are
+// returned as a [ShaderErrorList] with line and column information
+// and source snippets for each error. Include directives are also
+// supported (see [SetIncludeFS]()).
+func CompileShader(program []byte) (*ebiten.Shader, error) {
+	shader, _, err := compileShader(program, "")
+	return shader, err
+}
+
+// Expands the include directives of the program (see [SetIncludeFS]())
+// and compiles it. The expanded source is also returned, or nil if the
+// expansion failed. Error positions refer to the original files.
+func compileShader(program []byte, file string) (*ebiten.Shader, *shaderSource, error) {
+	source, err := expandIncludes(program, file)
+	if err != nil { return nil, nil, err }
+	shader, err := ebiten.NewShader(source.program)
+	if err != nil {
+		errs := newShaderErrorList(err, source.program, file)
+		source.mapErrors(errs)
+		return nil, source, errs
+	}
+	return shader, source, nil
+}
+
+var reShaderErrorPos = regexp.MustCompile(`^(\d+):(\d+): (.*)$`)
+
+// Parses an error returned by ebiten.NewShader() into a ShaderErrorList.
+func newShaderErrorList(err error, program []byte, file string) ShaderErrorList {
+	var errs ShaderErrorList
+
+	// go/parser errors get truncated on Error(), so we look at them directly
+	var scanErrs scanner.ErrorList
+	if errors.As(err, &scanErrs) {
+		for _, scanErr := range scanErrs {
+			errs = append(errs, &ShaderError{
+				File: file,
+				Line: scanErr.Pos.Line,
+				Column: scanErr.Pos.Column,
+				Message: scanErr.Msg,
+			})
+		}
+	} else {
+		// other errors come one per line, possibly with a position
+		for _, line := range strings.Split(err.Error(), "\n") {
+			if strings.TrimSpace(line) == "" { continue }
+			matches := reShaderErrorPos.FindStringSubmatch(line)
+			if matches == nil {
+				errs = append(errs, &ShaderError{ File: file, Message: line })
+				continue
+			}
+			lineNum, _ := strconv.Atoi(matches[1])
+			colNum,  _ := strconv.Atoi(matches[2])
+			errs = append(errs, &ShaderError{
+				File: file, Line: lineNum, Column: colNum, Message: matches[3],
+			})
+		}
+	}
+
+	// add source snippets
+	lines := strings.Split(string(program), "\n")
+	for _, shaderErr := range errs {
+		shaderErr.Snippet = sourceSnippet(lines, shaderErr.Line, shaderErr.Column)
+	}
+	return errs
+}
+
+// Returns the given line with a few lines of context and a caret
+// pointing at the given column. Tabs are expanded to keep the caret
+// aligned. Returns an empty string if the line is out of range.
+func sourceSnippet(lines []string, line, column int) string {
+	if line < 1 || line > len(lines) { return "" }
+
+	first := line - shaderErrorContextLines
+	if first < 1 { first = 1 }
+	last := line + shaderErrorContextLines
+	if last > len(lines) { last = len(lines) }
+	numWidth := len(strconv.Itoa(last))
+
+	var builder strings.Builder
+	for i := first; i <= last; i++ {
+		content := strings.TrimRight(lines[i - 1], "\r")
+		marker := "  "
+		if i == line { marker = "> " }
+		fmt.Fprintf(&builder, "%s%*d | %s\n", marker, numWidth, i, expandTabs(content))
+		if i == line && column > 0 {
+			// compute caret position on the expanded line
+			prefix := content
+			if column - 1 < len(prefix) { prefix = prefix[ : column - 1] }
+			padding := strings.Repeat(" ", len(expandTabs(prefix)))
+			fmt.Fprintf(&builder, "  %*s | %s^\n", numWidth, "", padding)
+		}
+	}
+	return strings.TrimRight(builder.String(), "\n")
+}
+
+func expandTabs(str string) string {
+	return strings.ReplaceAll(str, "\t", "    ")
+}
+
+// Prints the given compilation error to the terminal and stores it
+// to be displayed on screen. The action is "load" or "reload", and
+// the name identifies the program, like "shader" or "pass 0". The
+// kept flag indicates whether a previous shader is still being used.
+func (self *shaderDisplayer) storeCompileErr(action string, name string, err error, kept bool) {
+	title := "Failed to " + action + " " + name
+	var details string
+	var errList ShaderErrorList
+	if errors.As(err, &errList) {
+		details = errList.Verbose()
+	} else {
+		details = err.Error()
+	}
+	fmt.Printf("%s:\n%s\n\n", title, details)
+	if kept {
+		title += " (previous shader kept)"
+	}
+	self.compileErr = title + ":\n" + details
+	self.compileErrName = name
+}
+
+// Draws the last compilation error at the bottom of the screen.
+func (self *shaderDisplayer) drawCompileErr(screen *ebiten.Image) {
+	const charWidth, lineHeight = 6, 16
+	lines := strings.Split(self.compileErr, "\n")
+	var maxLen int
+	for _, line := range lines {
+		if len(line) > maxLen { maxLen = len(line) }
+	}
+
+	bounds := screen.Bounds()
+	width  := float32(maxLen*charWidth + 8)
+	height := float32(len(lines)*lineHeight + 4)
+	x := float32(bounds.Min.X)
+	y := float32(bounds.Max.Y) - height
+	if y < float32(bounds.Min.Y) { y = float32(bounds.Min.Y) }
+	vector.DrawFilledRect(screen, x, y, width, height, color.RGBA{96, 0, 0, 216}, false)
+	ebitenutil.DebugPrintAt(screen, self.compileErr, int(x) + 4, int(y) + 2)
+}
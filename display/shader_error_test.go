@@ -0,0 +1,96 @@
+package display
+
+import "errors"
+import "testing"
+import "go/token"
+import "go/scanner"
+
+func TestNewShaderErrorList(t *testing.T) {
+	program := []byte("package main\n\nfunc Fragment() vec4 {\n\treturn Color\n}")
+	tests := []struct {
+		err error
+		expected []string // Error() of each ShaderError
+	}{
+		{
+			errors.New("4:9: undefined: Color\n5:1: missing return\n\nlinking failed"),
+			[]string{ "main.kage:4:9: undefined: Color", "main.kage:5:1: missing return", "main.kage: linking failed" },
+		},
+		{
+			scanner.ErrorList{
+				{ Pos: token.Position{ Line: 3, Column: 6 }, Msg: "expected '('" },
+				{ Pos: token.Position{ Line: 4, Column: 2 }, Msg: "expected ';'" },
+			},
+			[]string{ "main.kage:3:6: expected '('", "main.kage:4:2: expected ';'" },
+		},
+	}
+	for _, test := range tests {
+		errs := newShaderErrorList(test.err, program, "main.kage")
+		if len(errs) != len(test.expected) {
+			t.Errorf("expected %d errors, got %d: %v", len(test.expected), len(errs), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != test.expected[i] {
+				t.Errorf("expected '%s', got '%s'", test.expected[i], err.Error())
+			}
+			if (err.Line == 0) != (err.Snippet == "") {
+				t.Errorf("'%s': snippets are expected if and only if the error has a line", err.Error())
+			}
+		}
+	}
+}
+
+func TestSourceSnippet(t *testing.T) {
+	lines := []string{ "package main", "", "func f() {", "\tx :=\t1", "}" }
+	tests := []struct {
+		line, column int
+		expected string
+	}{
+		{ // tabs are expanded and the caret stays aligned
+			4, 7,
+			"  2 | \n" +
+			"  3 | func f() {\n" +
+			"> 4 |     x :=    1\n" +
+			"    |             ^\n" +
+			"  5 | }",
+		},
+		{ // last line
+			5, 1,
+			"  3 | func f() {\n" +
+			"  4 |     x :=    1\n" +
+			"> 5 | }\n" +
+			"    | ^",
+		},
+		{ // first line, no column
+			1, 0,
+			"> 1 | package main\n" +
+			"  2 | \n" +
+			"  3 | func f() {",
+		},
+		{ // column past the end of the line
+			1, 40,
+			"> 1 | package main\n" +
+			"    |             ^\n" +
+			"  2 | \n" +
+			"  3 | func f() {",
+		},
+		{ 6, 1, "" }, // past the end of the source
+		{ 0, 1, "" },
+	}
+	for _, test := range tests {
+		snippet := sourceSnippet(lines, test.line, test.column)
+		if snippet != test.expected {
+			t.Errorf("line %d, column %d: expected\n%s\ngot\n%s", test.line, test.column, test.expected, snippet)
+		}
+	}
+}
+
+func TestSourceSnippetWidth(t *testing.T) {
+	lines := make([]string, 12)
+	lines[9] = "\tbad"
+	expected := "   8 | \n   9 | \n> 10 |     bad\n     |     ^\n  11 | \n  12 | "
+	snippet := sourceSnippet(lines, 10, 2)
+	if snippet != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, snippet)
+	}
+}
@@ -0,0 +1,130 @@
+package display
+
+import "fmt"
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Feedback image settings, see LinkFeedbackImage().
+var feedbackIndex int = -1 // -1 if no feedback image is linked
+var feedbackInitial any // nil, *ebiten.Image or AutoTexture
+
+// Links the previous frame's output of the shader to Images[n],
+// which allows creating stateful effects like trails, cellular
+// automata or reaction-diffusion. The given n can only be 0, 1,
+// 2 or 3, and takes precedence over any image linked with
+// [LinkShaderImage]() for the same index.
+//
+// The initial image can be nil (transparent), an *ebiten.Image,
+// like [ImageSpiderCatDog](), or an [AutoTexture], like [TexNoiseColor].
+// It's stretched to the canvas size, and it's restored when pressing
+// Backspace or when the canvas is resized. While the Time uniform is
+// paused, the feedback only advances when stepping frames.
+//
+// Only one feedback image can be linked. With [Pipeline](), the
+// feedback image is the output of the last pass, and it can also
+// be used on earlier passes.
+func LinkFeedbackImage(n int, initial any) {
+	if n < 0 || n > 3 { panic("n must be between 0 and 3") }
+	switch typedInitial := initial.(type) {
+	case nil:
+		feedbackInitial = nil
+	case *ebiten.Image:
+		if typedInitial == nil {
+			feedbackInitial = nil
+		} else {
+			feedbackInitial = typedInitial
+		}
+	case AutoTexture:
+		feedbackInitial = typedInitial
+	default:
+		panic(fmt.Sprintf("unexpected initial image of type %T on LinkFeedbackImage()", initial))
+	}
+	feedbackIndex = n
+}
+
+// Two images alternating as the previous and current output of
+// the main shader.
+type feedbackBuffer struct {
+	index int // shader image index
+	initial any
+	images [2]*ebiten.Image
+	current int // index of the current output on images
+	resetRequested bool
+	stepPending bool
+	lastSeconds float32
+}
+
+func newFeedbackBuffer(index int, initial any) *feedbackBuffer {
+	return &feedbackBuffer{ index: index, initial: initial, resetRequested: true }
+}
+
+// Returns the image to use as the shader input: the last output,
+// or the one before that if the current step has already been drawn.
+func (self *feedbackBuffer) input() *ebiten.Image {
+	if self.stepPending { return self.images[self.current] }
+	return self.images[1 - self.current]
+}
+
+// Requests a feedback step for the current draw. While the time
+// is paused, steps are only requested if the time changes.
+func (self *feedbackBuffer) Request(seconds float32, paused bool) {
+	if !paused || seconds != self.lastSeconds || self.resetRequested {
+		self.stepPending = true
+	}
+	self.lastSeconds = seconds
+}
+
+// Creates the images if necessary and restores the initial image
+// if a reset was requested or the canvas size changed.
+func (self *feedbackBuffer) Prepare(canvas image.Rectangle) {
+	size := canvas.Size()
+	if self.images[0] == nil || self.images[0].Bounds().Size() != size {
+		self.resetRequested = true
+		self.stepPending = true
+	}
+	if !self.resetRequested { return }
+	self.images[0] = resetImage(self.images[0], size)
+	self.images[1] = resetImage(self.images[1], size)
+	self.drawInitial(canvas)
+	self.resetRequested = false
+}
+
+// Draws the main shader output to the target, advancing the
+// feedback first if a step is pending.
+func (self *shaderDisplayer) drawFeedback(target *ebiten.Image, canvas image.Rectangle) {
+	fb := self.feedback
+	size := canvas.Size()
+	if fb.stepPending {
+		fb.current = 1 - fb.current
+		fb.stepPending = false
+		fb.images[fb.current].Clear()
+		self.drawProgramOutput(self.shader, fb.images[fb.current], canvas)
+	}
+
+	var opts ebiten.DrawImageOptions
+	bounds := target.Bounds()
+	opts.GeoM.Scale(float64(bounds.Dx())/float64(size.X), float64(bounds.Dy())/float64(size.Y))
+	opts.GeoM.Translate(float64(bounds.Min.X), float64(bounds.Min.Y))
+	target.DrawImage(fb.images[fb.current], &opts)
+}
+
+// Draws the initial image, stretched, as the current output.
+func (self *feedbackBuffer) drawInitial(canvas image.Rectangle) {
+	var initial *ebiten.Image
+	switch typedInitial := self.initial.(type) {
+	case nil:
+		return
+	case *ebiten.Image:
+		initial = typedInitial
+	case AutoTexture:
+		initial = getAutoTexture(typedInitial, canvas)
+	default:
+		panic("unreachable")
+	}
+
+	var opts ebiten.DrawImageOptions
+	bounds := initial.Bounds()
+	opts.GeoM.Scale(float64(canvas.Dx())/float64(bounds.Dx()), float64(canvas.Dy())/float64(bounds.Dy()))
+	self.images[self.current].DrawImage(initial, &opts)
+}
@@ -0,0 +1,166 @@
+package display
+
+import "fmt"
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Ways to map a linked image to the shader source coordinates.
+// See [SetShaderImageMapping]().
+type ImageMapping uint8
+const (
+	MapStretch ImageMapping = iota // image stretched to the source region (default)
+	MapNative // image at its native size on the top-left corner, transparent elsewhere
+	MapTiled  // image at its native size, repeated to fill the source region
+)
+
+func (self ImageMapping) String() string {
+	switch self {
+	case MapStretch: return "MapStretch"
+	case MapNative : return "MapNative"
+	case MapTiled  : return "MapTiled"
+	default:
+		return fmt.Sprintf("ImageMapping(%d)", self)
+	}
+}
+
+var shaderImageMappings [4]ImageMapping
+
+// Sets how the image linked at Images[n] is mapped to the shader
+// source coordinates. The given n can only be 0, 1, 2 or 3.
+//
+// All source images are given to the shader with the same size. The
+// source region takes the size of the first image with [MapStretch]
+// mapping, or the canvas size if no image is stretched, and it's
+// always stretched to cover the whole canvas. Images with [MapNative]
+// or [MapTiled] mapping keep their size relative to that region.
+func SetShaderImageMapping(n int, mapping ImageMapping) {
+	if n < 0 || n > 3 { panic("n must be between 0 and 3") }
+	switch mapping {
+	case MapStretch, MapNative, MapTiled:
+		shaderImageMappings[n] = mapping
+	default:
+		panic(fmt.Sprintf("invalid image mapping %d", mapping))
+	}
+}
+
+// Returns the default image for the given index, used when the
+// shader uses the image but nothing has been linked to it.
+func getDefaultShaderImage(n int, canvas image.Rectangle) *ebiten.Image {
+	switch n {
+	case 0: return ImageSpiderCatDog()
+	case 1: return ImageWaterfall()
+	case 2: return getAutoTexture(TexNoiseColor, canvas)
+	case 3: return getAutoTexture(TexTriangleColor, canvas)
+	default:
+		panic("n must be between 0 and 3")
+	}
+}
+
+// Sets the shader source images and returns the source region that
+// has to be mapped to the canvas.
+func (self *shaderDisplayer) linkSourceImages(canvas image.Rectangle) image.Rectangle {
+	var explicit [4]any
+	if self.pipeline != nil { explicit = self.pipeline.images }
+	sources, mappings := self.sourceImages(explicit, self.usingImages, canvas)
+	return self.linkImages(sources, mappings, &self.imageAdapters, canvas)
+}
+
+// Returns the source images for a program and their mappings. Explicit
+// images can be given for each index (see [Pass].Images); otherwise,
+// linked images are used, or default ones if the program uses them.
+func (self *shaderDisplayer) sourceImages(explicit [4]any, usingImages [4]bool, canvas image.Rectangle) ([4]*ebiten.Image, [4]ImageMapping) {
+	var sources [4]*ebiten.Image
+	mappings := shaderImageMappings
+	for n := 0; n < 4; n++ {
+		if explicit[n] != nil {
+			sources[n], mappings[n] = self.resolvePassImage(n, explicit[n], canvas)
+			continue
+		}
+		if self.feedback != nil && self.feedback.index == n && self.feedback.input() != nil {
+			sources[n] = self.feedback.input()
+		} else if self.fixedImages != nil {
+			sources[n] = self.fixedImages[n]
+		} else {
+			sources[n] = getLinkedShaderImage(n, canvas)
+		}
+		if sources[n] == nil && usingImages[n] {
+			sources[n] = getDefaultShaderImage(n, canvas)
+		}
+	}
+	return sources, mappings
+}
+
+// Sets the given images as the shader source images, adapting them
+// to a common size when necessary, and returns the source region.
+// If there are no images, the given default region is returned.
+// Adapted images are drawn to the given adapters, which should be
+// different for each program to avoid reallocating them.
+func (self *shaderDisplayer) linkImages(sources [4]*ebiten.Image, mappings [4]ImageMapping, adapters *[4]*ebiten.Image, defaultRegion image.Rectangle) image.Rectangle {
+	// find the reference size
+	refSize := defaultRegion.Size()
+	for n, source := range sources {
+		if source != nil && mappings[n] == MapStretch {
+			refSize = source.Bounds().Size()
+			break
+		}
+	}
+
+	// adapt images to the reference size when necessary
+	var srcRect image.Rectangle
+	for n, source := range sources {
+		if source == nil {
+			self.options.Images[n] = nil
+			continue
+		}
+
+		bounds := source.Bounds()
+		if mappings[n] != MapStretch || bounds.Size() != refSize {
+			source = adaptSourceImage(&adapters[n], source, mappings[n], refSize)
+			bounds = source.Bounds()
+		}
+		self.options.Images[n] = source
+		if srcRect.Empty() { srcRect = bounds }
+	}
+
+	if srcRect.Empty() { return defaultRegion }
+	return srcRect
+}
+
+// Draws the source image into the adapter image, which is resized to
+// the given size if necessary, following the given image mapping.
+func adaptSourceImage(adapter **ebiten.Image, source *ebiten.Image, mapping ImageMapping, size image.Point) *ebiten.Image {
+	target := *adapter
+	if target == nil || target.Bounds().Size() != size {
+		if target != nil { target.Dispose() }
+		target = ebiten.NewImage(size.X, size.Y)
+		*adapter = target
+	} else {
+		target.Clear()
+	}
+
+	bounds := source.Bounds()
+	var vertices [4]ebiten.Vertex
+	var opts ebiten.DrawTrianglesOptions
+	dxl, dxr := float32(0), float32(size.X)
+	dyt, dyb := float32(0), float32(size.Y)
+	sxl, syt := float32(bounds.Min.X), float32(bounds.Min.Y)
+	switch mapping {
+	case MapStretch:
+		PositionRectVertices(&vertices, sxl, float32(bounds.Max.X), syt, float32(bounds.Max.Y), dxl, dxr, dyt, dyb)
+	case MapNative:
+		opts.Address = ebiten.AddressClampToZero
+		PositionRectVertices(&vertices, sxl, sxl + dxr, syt, syt + dyb, dxl, dxr, dyt, dyb)
+	case MapTiled:
+		opts.Address = ebiten.AddressRepeat
+		PositionRectVertices(&vertices, sxl, sxl + dxr, syt, syt + dyb, dxl, dxr, dyt, dyb)
+	default:
+		panic("unreachable")
+	}
+	for i := 0; i < 4; i++ {
+		vertices[i].ColorR, vertices[i].ColorG = 1.0, 1.0
+		vertices[i].ColorB, vertices[i].ColorA = 1.0, 1.0
+	}
+	target.DrawTriangles(vertices[0 : 4], []uint16{0, 1, 2, 1, 2, 3}, source, &opts)
+	return target
+}
@@ -0,0 +1,169 @@
+package display
+
+import "os"
+import "fmt"
+import "errors"
+import "path"
+import "io/fs"
+import "strconv"
+import "strings"
+import "path/filepath"
+
+const includeDirective = "//kage-desk:include"
+
+var includeFS fs.FS // nil to read included files from disk
+
+// Sets the file system used to resolve include directives in
+// shaders, like an embed.FS. If nil (the default), included
+// files are read from disk.
+//
+// Shaders can include other files with a directive on its own line,
+// like '//kage-desk:include "common/color.kage"'. Paths are relative
+// to the directory of the including file, or to the working directory
+// for shaders not loaded from a file. When a file system is set, paths
+// on the main shader are always relative to the root of the file system
+// instead, as the main shader is not necessarily part of it, and paths
+// can't be rooted nor point outside the file system.
+// Each file is included only once, even if multiple files include it,
+// and include cycles are reported as compilation errors. Package clauses
+// and '//kage:' directives in included files are ignored, so they can
+// also be valid shaders on their own. Included files are hot-reloaded
+// along the main shader file.
+func SetIncludeFS(fsys fs.FS) {
+	includeFS = fsys
+}
+
+// A shader program with its include directives expanded.
+type shaderSource struct {
+	program []byte
+	origins []lineOrigin // original file and line for each line of the program
+	lines map[string][]string // source lines of each file
+	includes []string // included file paths, if read from disk
+}
+
+type lineOrigin struct {
+	file string
+	line int // 1-based
+}
+
+// Expands the include directives of the given program. The file
+// can be empty if the program wasn't loaded from a file. Errors
+// are returned as a [ShaderErrorList].
+func expandIncludes(program []byte, file string) (*shaderSource, error) {
+	source := &shaderSource{ lines: make(map[string][]string) }
+	var builder strings.Builder
+	included := make(map[string]bool)
+	err := source.expand(&builder, program, file, nil, included)
+	if err != nil { return nil, err }
+	source.program = []byte(builder.String())
+	return source, nil
+}
+
+// Writes the given file to the builder, recursively expanding
+// its include directives. The stack contains the including files.
+func (self *shaderSource) expand(builder *strings.Builder, program []byte, file string, stack []string, included map[string]bool) error {
+	lines := strings.Split(string(program), "\n")
+	self.lines[file] = lines
+	if len(stack) == 0 && file != "" {
+		stack = append(stack, cleanIncludePath(file)) // (included paths are already clean)
+	} else {
+		stack = append(stack, file)
+	}
+	for i, line := range lines {
+		origin := lineOrigin{ file, i + 1 }
+		trimmed := strings.TrimSpace(line)
+		if len(stack) > 1 && (strings.HasPrefix(trimmed, "package ") || strings.HasPrefix(trimmed, "//kage:")) {
+			self.writeLine(builder, "", origin)
+			continue
+		}
+		if !strings.HasPrefix(trimmed, includeDirective) {
+			self.writeLine(builder, line, origin)
+			continue
+		}
+
+		// parse and resolve the include directive
+		includePath, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, includeDirective)))
+		if err != nil || includePath == "" {
+			return self.errorAt(origin, "invalid include directive, expected " + includeDirective + " \"path/to/file.kage\"")
+		}
+		includeFile, err := resolveInclude(file, includePath, len(stack) == 1)
+		if err != nil {
+			return self.errorAt(origin, fmt.Sprintf("failed to include '%s': %s", includePath, err.Error()))
+		}
+		for j, stackFile := range stack {
+			if stackFile != includeFile { continue }
+			cycle := append(append([]string{}, stack[j : ]...), includeFile)
+			return self.errorAt(origin, "include cycle: " + strings.Join(cycle, " -> "))
+		}
+		if included[includeFile] {
+			self.writeLine(builder, "", origin) // already included
+			continue
+		}
+		included[includeFile] = true
+
+		content, err := readInclude(includeFile)
+		if err != nil {
+			return self.errorAt(origin, fmt.Sprintf("failed to include '%s': %s", includePath, err.Error()))
+		}
+		if includeFS == nil {
+			self.includes = append(self.includes, includeFile)
+		}
+		err = self.expand(builder, content, includeFile, stack, included)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+func (self *shaderSource) writeLine(builder *strings.Builder, line string, origin lineOrigin) {
+	if len(self.origins) > 0 { builder.WriteByte('\n') }
+	builder.WriteString(line)
+	self.origins = append(self.origins, origin)
+}
+
+func (self *shaderSource) errorAt(origin lineOrigin, msg string) error {
+	return ShaderErrorList{&ShaderError{
+		File: origin.file,
+		Line: origin.line,
+		Column: 1,
+		Message: msg,
+		Snippet: sourceSnippet(self.lines[origin.file], origin.line, 1),
+	}}
+}
+
+// Maps the positions of the given errors from the expanded
+// program back to the original files.
+func (self *shaderSource) mapErrors(errs ShaderErrorList) {
+	for _, shaderErr := range errs {
+		if shaderErr.Line < 1 || shaderErr.Line > len(self.origins) { continue }
+		origin := self.origins[shaderErr.Line - 1]
+		shaderErr.File = origin.file
+		shaderErr.Line = origin.line
+		shaderErr.Snippet = sourceSnippet(self.lines[origin.file], origin.line, shaderErr.Column)
+	}
+}
+
+// Returns the path of an included file, relative to the including
+// file. With an include FS, paths on the main file are relative to
+// the root of the FS, as the main file may not even be part of it.
+func resolveInclude(file string, includePath string, isMain bool) (string, error) {
+	if includeFS != nil {
+		if path.IsAbs(includePath) { return "", errors.New("paths can't be rooted when using an include FS") }
+		dir := "."
+		if !isMain { dir = path.Dir(file) }
+		resolved := path.Join(dir, includePath)
+		if !fs.ValidPath(resolved) { return "", errors.New("path is outside the include FS") }
+		return resolved, nil
+	}
+	if filepath.IsAbs(includePath) { return filepath.Clean(includePath), nil }
+	return filepath.Join(filepath.Dir(file), filepath.FromSlash(includePath)), nil
+}
+
+func cleanIncludePath(file string) string {
+	if includeFS != nil { return path.Clean(filepath.ToSlash(file)) }
+	return filepath.Clean(file)
+}
+
+func readInclude(file string) ([]byte, error) {
+	if includeFS != nil { return fs.ReadFile(includeFS, file) }
+	return os.ReadFile(file)
+}
@@ -0,0 +1,122 @@
+package display
+
+import "os"
+import "errors"
+import "strings"
+import "testing"
+import "path/filepath"
+import "testing/fstest"
+
+func TestExpandIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "main.kage", "//kage:unit pixels\npackage main\n//kage-desk:include \"lib/a.kage\"\n//kage-desk:include \"lib/b.kage\"\nfunc main() {}")
+	writeTestFile(t, dir, "lib/a.kage", "package main\n//kage-desk:include \"b.kage\"\nfunc a() {}")
+	writeTestFile(t, dir, "lib/b.kage", "//kage:unit pixels\nfunc b() {}")
+
+	mainFile := filepath.Join(dir, "main.kage")
+	program, err := os.ReadFile(mainFile)
+	if err != nil { t.Fatal(err) }
+	source, err := expandIncludes(program, mainFile)
+	if err != nil { t.Fatal(err) }
+
+	// package clauses and kage directives are blanked on included files,
+	// and b.kage is only included once
+	expected := "//kage:unit pixels\npackage main\n\n\nfunc b() {}\nfunc a() {}\n\nfunc main() {}"
+	if string(source.program) != expected {
+		t.Fatalf("expected program:\n%s\ngot:\n%s", expected, source.program)
+	}
+
+	libA, libB := filepath.Join(dir, "lib", "a.kage"), filepath.Join(dir, "lib", "b.kage")
+	expectedOrigins := []lineOrigin{
+		{ mainFile, 1 }, { mainFile, 2 },
+		{ libA, 1 }, { libB, 1 }, { libB, 2 }, { libA, 3 },
+		{ mainFile, 4 }, { mainFile, 5 },
+	}
+	if len(source.origins) != len(expectedOrigins) {
+		t.Fatalf("expected %d origins, got %d", len(expectedOrigins), len(source.origins))
+	}
+	for i, origin := range expectedOrigins {
+		if source.origins[i] != origin {
+			t.Errorf("line %d: expected origin %v, got %v", i + 1, origin, source.origins[i])
+		}
+	}
+	if len(source.includes) != 2 || source.includes[0] != libA || source.includes[1] != libB {
+		t.Errorf("unexpected includes %v", source.includes)
+	}
+}
+
+func TestIncludeErrorMapping(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "common.kage", "func helper() float {\n\treturn 1\n}")
+	mainFile := filepath.Join(dir, "main.kage")
+	program := []byte("package main\n//kage-desk:include \"common.kage\"\nfunc main() {}")
+	source, err := expandIncludes(program, mainFile)
+	if err != nil { t.Fatal(err) }
+
+	errs := ShaderErrorList{
+		{ Line: 3, Column: 2, Message: "in include" },
+		{ Line: 5, Column: 6, Message: "in main" },
+		{ Line: 0, Column: 0, Message: "no position" },
+	}
+	source.mapErrors(errs)
+	expected := []string{
+		filepath.Join(dir, "common.kage") + ":2:2: in include",
+		mainFile + ":3:6: in main",
+		"no position",
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] { t.Errorf("expected '%s', got '%s'", expected[i], err.Error()) }
+	}
+	if !strings.Contains(errs[0].Snippet, "> 2 |     return 1\n") {
+		t.Errorf("snippet not mapped to the included file:\n%s", errs[0].Snippet)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.kage", "//kage-desk:include \"b.kage\"")
+	writeTestFile(t, dir, "b.kage", "\n//kage-desk:include \"a.kage\"")
+	mainFile := filepath.Join(dir, "main.kage")
+	_, err := expandIncludes([]byte("package main\n//kage-desk:include \"a.kage\""), mainFile)
+
+	var errs ShaderErrorList
+	if !errors.As(err, &errs) || len(errs) != 1 { t.Fatalf("expected a single ShaderError, got %v", err) }
+	fileA, fileB := filepath.Join(dir, "a.kage"), filepath.Join(dir, "b.kage")
+	if errs[0].File != fileB || errs[0].Line != 2 {
+		t.Errorf("expected error at %s:2, got %s:%d", fileB, errs[0].File, errs[0].Line)
+	}
+	if !strings.Contains(errs[0].Message, "include cycle: " + fileA + " -> " + fileB + " -> " + fileA) {
+		t.Errorf("unexpected message '%s'", errs[0].Message)
+	}
+}
+
+func TestIncludeFS(t *testing.T) {
+	defer SetIncludeFS(nil)
+	SetIncludeFS(fstest.MapFS{
+		"lib/a.kage": { Data: []byte("//kage-desk:include \"b.kage\"\nfunc a() {}") },
+		"lib/b.kage": { Data: []byte("func b() {}") },
+	})
+
+	// the main file path is unrelated to the FS, even if absolute
+	mainFile := filepath.Join(t.TempDir(), "main.kage")
+	source, err := expandIncludes([]byte("package main\n//kage-desk:include \"lib/a.kage\""), mainFile)
+	if err != nil { t.Fatal(err) }
+	if string(source.program) != "package main\nfunc b() {}\nfunc a() {}" {
+		t.Errorf("unexpected program:\n%s", source.program)
+	}
+	if len(source.includes) != 0 { t.Errorf("FS includes shouldn't be watched, got %v", source.includes) }
+
+	for _, includePath := range []string{ "/lib/a.kage", "../lib/a.kage" } {
+		_, err := expandIncludes([]byte("//kage-desk:include \"" + includePath + "\""), mainFile)
+		if err == nil { t.Errorf("expected error for include path '%s'", includePath) }
+	}
+}
+
+func writeTestFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil { t.Fatal(err) }
+	err = os.WriteFile(file, []byte(content), 0644)
+	if err != nil { t.Fatal(err) }
+}
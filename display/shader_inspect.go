@@ -0,0 +1,113 @@
+package display
+
+import "fmt"
+import "image"
+import "image/color"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+const inspectRadius = 5 // the loupe shows (2*radius + 1)^2 pixels
+const inspectZoom = 12  // size of each pixel in the loupe
+const inspectMargin = 20 // distance between the cursor and the loupe
+
+var (
+	inspectCheckerLight = color.RGBA{204, 204, 204, 255}
+	inspectCheckerDark  = color.RGBA{153, 153, 153, 255}
+)
+
+// Returns whether the pixel inspector is active (key I held).
+func (self *shaderDisplayer) isInspecting() bool {
+	return ebiten.IsKeyPressed(ebiten.KeyI) && self.recorder == nil
+}
+
+// Draws the shader into an offscreen image, so the raw output can be
+// inspected, and then composes it over the background on the screen.
+func (self *shaderDisplayer) drawInspectedFrame(screen *ebiten.Image) {
+	bounds := screen.Bounds()
+	if self.inspectImage == nil || self.inspectImage.Bounds() != bounds {
+		if self.inspectImage != nil { self.inspectImage.Dispose() }
+		self.inspectImage = ebiten.NewImage(bounds.Dx(), bounds.Dy())
+	} else {
+		self.inspectImage.Clear()
+	}
+	self.drawShaderOutput(self.inspectImage, bounds)
+	screen.Fill(winBackColor)
+	screen.DrawImage(self.inspectImage, nil)
+}
+
+// Draws the loupe and the pixel info next to the cursor.
+func (self *shaderDisplayer) drawInspector(screen *ebiten.Image) {
+	if !self.isInspecting() || self.inspectImage == nil { return }
+	bounds := screen.Bounds()
+	px, py := ebiten.CursorPosition()
+	if !image.Pt(px, py).In(bounds) || self.inspectImage.Bounds() != bounds { return }
+
+	// pixel info
+	rgba := color.RGBAModel.Convert(self.inspectImage.At(px, py)).(color.RGBA)
+	straight := color.NRGBAModel.Convert(rgba).(color.NRGBA)
+	cx, cy := float64(px) + 0.5, float64(py) + 0.5
+	nx, ny := (cx - float64(bounds.Min.X))/float64(bounds.Dx()), (cy - float64(bounds.Min.Y))/float64(bounds.Dy())
+	sx := float64(self.srcBounds.Min.X) + nx*float64(self.srcBounds.Dx())
+	sy := float64(self.srcBounds.Min.Y) + ny*float64(self.srcBounds.Dy())
+	lines := []string{
+		fmt.Sprintf("pixel (%d, %d)", px, py),
+		fmt.Sprintf("target (%.1f, %.1f)", cx, cy),
+		fmt.Sprintf("normalized (%.4f, %.4f)", nx, ny),
+		fmt.Sprintf("source (%.2f, %.2f)", sx, sy),
+		fmt.Sprintf("premult  RGBA(%d, %d, %d, %d)", rgba.R, rgba.G, rgba.B, rgba.A),
+		"         " + vec4String(rgba.R, rgba.G, rgba.B, rgba.A),
+		fmt.Sprintf("straight RGBA(%d, %d, %d, %d)", straight.R, straight.G, straight.B, straight.A),
+		"         " + vec4String(straight.R, straight.G, straight.B, straight.A),
+	}
+
+	// layout, avoiding the screen edges
+	loupeSize := (2*inspectRadius + 1)*inspectZoom
+	width := loupeSize
+	for _, line := range lines {
+		if len(line)*6 > width { width = len(line)*6 }
+	}
+	width += 8
+	height := loupeSize + len(lines)*16 + 12
+	x, y := px + inspectMargin, py + inspectMargin
+	if x + width > bounds.Max.X { x = px - inspectMargin - width }
+	if y + height > bounds.Max.Y { y = py - inspectMargin - height }
+	if x < bounds.Min.X { x = bounds.Min.X }
+	if y < bounds.Min.Y { y = bounds.Min.Y }
+	fillRect(screen, image.Rect(x, y, x + width, y + height), panelBackColor)
+
+	// loupe, with a checkerboard beneath to make transparency visible
+	loupe := image.Rect(x + 4, y + 4, x + 4 + loupeSize, y + 4 + loupeSize)
+	half := inspectZoom/2
+	for j := 0; j < loupeSize/half; j++ {
+		for i := 0; i < loupeSize/half; i++ {
+			clr := inspectCheckerLight
+			if (i + j) % 2 == 1 { clr = inspectCheckerDark }
+			cellX, cellY := loupe.Min.X + i*half, loupe.Min.Y + j*half
+			fillRect(screen, image.Rect(cellX, cellY, cellX + half, cellY + half), clr)
+		}
+	}
+	region := image.Rect(px - inspectRadius, py - inspectRadius, px + inspectRadius + 1, py + inspectRadius + 1)
+	source := self.inspectImage.SubImage(region).(*ebiten.Image)
+	var opts ebiten.DrawImageOptions
+	opts.GeoM.Scale(inspectZoom, inspectZoom)
+	offset := source.Bounds().Min.Sub(region.Min).Mul(inspectZoom) // (region may be clipped)
+	opts.GeoM.Translate(float64(loupe.Min.X + offset.X), float64(loupe.Min.Y + offset.Y))
+	screen.DrawImage(source, &opts)
+
+	// highlight the inspected pixel
+	centerX := float32(loupe.Min.X + inspectRadius*inspectZoom)
+	centerY := float32(loupe.Min.Y + inspectRadius*inspectZoom)
+	vector.StrokeRect(screen, centerX - 1, centerY - 1, inspectZoom + 2, inspectZoom + 2, 1, color.Black, false)
+	vector.StrokeRect(screen, centerX, centerY, inspectZoom, inspectZoom, 1, color.White, false)
+
+	// info text
+	for i, line := range lines {
+		ebitenutil.DebugPrintAt(screen, line, x + 4, loupe.Max.Y + 4 + i*16)
+	}
+}
+
+func vec4String(r, g, b, a uint8) string {
+	return fmt.Sprintf("vec4(%.3f, %.3f, %.3f, %.3f)", float64(r)/255.0, float64(g)/255.0, float64(b)/255.0, float64(a)/255.0)
+}
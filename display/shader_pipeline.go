@@ -0,0 +1,209 @@
+package display
+
+import "os"
+import "fmt"
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// A shader pass for [Pipeline]().
+type Pass struct {
+	// The shader program, either as a []byte or as the path
+	// to a .kage file (string). Files are hot-reloaded.
+	Program any
+
+	// Size of the offscreen image the pass is drawn to. If zero,
+	// the canvas size is used. Must be zero on the last pass, as
+	// that one is always drawn to the canvas.
+	Width, Height int
+
+	// Sources for imageSrc0 to imageSrc3. Each one can be nil, an
+	// *ebiten.Image, an [AutoTexture] or a [PassOutput] referring
+	// to an earlier pass. Nil images work like in [Shader](): the
+	// images linked with [LinkShaderImage]() are used, or the default
+	// sample textures if the program uses them.
+	Images [4]any
+}
+
+// Refers to the output of the pass with the given index. Can be
+// used on the [Pass].Images of any later pass.
+type PassOutput int
+
+// Like [Shader](), but draws multiple shader passes in sequence.
+// Each pass is drawn to an offscreen image that later passes can
+// use as a source image through [PassOutput], and the last pass
+// is drawn to the canvas. For example, a separable blur:
+//   display.Pipeline(
+//       display.Pass{ Program: "blur_horz.kage" },
+//       display.Pass{
+//           Program: "blur_vert.kage",
+//           Images: [4]any{ display.PassOutput(0) },
+//       },
+//   )
+//
+// All passes receive the same uniforms, with the exception of
+// 'Resolution', which is set to the size of each pass target.
+// Comment macros from all passes are combined. Pass outputs are
+// always stretched to the source region, regardless of the
+// [SetShaderImageMapping]() configuration.
+func Pipeline(passes ...Pass) {
+	if len(passes) == 0 { panic("Pipeline() requires at least one pass") }
+	if argComparePath != "" {
+		warn("--compare program flag ignored on display.Pipeline()")
+	}
+
+	pipeline := &shaderPipeline{}
+	var programBytes []byte
+	var programPath string
+	for i, pass := range passes {
+		if pass.Width < 0 || pass.Height < 0 || (pass.Width == 0) != (pass.Height == 0) {
+			panic(fmt.Sprintf("invalid target size %dx%d on pass %d", pass.Width, pass.Height, i))
+		}
+		for n, img := range pass.Images {
+			switch typedImg := img.(type) {
+			case nil, AutoTexture:
+				// fine
+			case *ebiten.Image:
+				if typedImg == nil { pass.Images[n] = nil }
+			case PassOutput:
+				if typedImg < 0 || int(typedImg) >= i {
+					panic(fmt.Sprintf("pass %d can only use outputs of earlier passes (got PassOutput(%d))", i, typedImg))
+				}
+			default:
+				panic(fmt.Sprintf("unexpected image of type %T on pass %d", img, i))
+			}
+		}
+
+		bytes, path := loadPassProgram(i, pass.Program)
+		if i == len(passes) - 1 {
+			if pass.Width != 0 { panic("the last pass can't have a target size") }
+			pipeline.images = pass.Images
+			programBytes, programPath = bytes, path
+		} else {
+			pipeline.passes = append(pipeline.passes, &shaderPass{
+				index: i,
+				programBytes: bytes,
+				width: pass.Width,
+				height: pass.Height,
+				images: pass.Images,
+			})
+			if path != "" {
+				pipeline.passes[i].watcher = newShaderWatcher(path)
+			}
+		}
+	}
+
+	displayer := newShaderDisplayer()
+	displayer.setPipeline(pipeline)
+	runShader(displayer, programBytes, programPath)
+}
+
+// Returns the program bytes and the file path ("" if not a file).
+func loadPassProgram(index int, program any) ([]byte, string) {
+	switch typedProgram := program.(type) {
+	case string:
+		bytes, err := os.ReadFile(typedProgram)
+		if err != nil { fail(err.Error()) }
+		if len(bytes) == 0 { fail("shader file '" + typedProgram + "' is empty") }
+		return bytes, typedProgram
+	case []byte:
+		if len(typedProgram) == 0 { fail(fmt.Sprintf("received empty []byte shader on pass %d", index)) }
+		return typedProgram, ""
+	default:
+		panic(fmt.Sprintf("unexpected program of type %T on pass %d", program, index))
+	}
+}
+
+type shaderPipeline struct {
+	passes []*shaderPass // all but the last one, which is the main program
+	images [4]any // explicit images for the last pass
+}
+
+type shaderPass struct {
+	index int
+	shader *ebiten.Shader // may be nil if the compilation failed
+	programBytes []byte
+	usingImages [4]bool
+	watcher *shaderWatcher // nil if the shader wasn't loaded from a file
+	width, height int // zero for the canvas size
+	images [4]any
+	imageAdapters [4]*ebiten.Image // see shader_images.go
+	output *ebiten.Image
+}
+
+func (self *shaderPass) setProgram(shader *ebiten.Shader, programBytes []byte) {
+	self.shader = shader
+	self.programBytes = programBytes
+	for n := 0; n < 4; n++ {
+		self.usingImages[n] = containsOutsideComment(programBytes, []rune(fmt.Sprintf("imageSrc%d", n)))
+	}
+}
+
+func (self *shaderPass) size(canvas image.Rectangle) image.Point {
+	if self.width == 0 { return canvas.Size() }
+	return image.Pt(self.width, self.height)
+}
+
+// Sets up the pipeline and compiles all its passes except the
+// last one. Must be called before setProgram() for the main shader.
+func (self *shaderDisplayer) setPipeline(pipeline *shaderPipeline) {
+	self.pipeline = pipeline
+	for _, pass := range pipeline.passes {
+		path := ""
+		if pass.watcher != nil { path = pass.watcher.path }
+		shader, source, err := compileShader(pass.programBytes, path)
+		if err != nil {
+			self.storeCompileErr("load", fmt.Sprintf("pass %d", pass.index), err, false)
+		}
+		if source == nil {
+			pass.setProgram(shader, pass.programBytes)
+		} else {
+			pass.setProgram(shader, source.program)
+			if pass.watcher != nil { pass.watcher.SetIncludes(source.includes) }
+		}
+	}
+}
+
+// Like hotReload, but for the passes before the last one.
+func (self *shaderDisplayer) hotReloadPasses() {
+	for _, pass := range self.pipeline.passes {
+		if pass.watcher == nil { continue }
+		name := fmt.Sprintf("pass %d", pass.index)
+		self.reloadProgram(pass.watcher, name, pass.shader, func(shader *ebiten.Shader, programBytes []byte) {
+			pass.setProgram(shader, programBytes)
+			self.setProgram(self.shader, self.programBytes)
+		})
+	}
+}
+
+// Draws all the passes before the last one to their output images.
+func (self *shaderDisplayer) drawPasses(canvas image.Rectangle) {
+	resolution, hasResolution := self.options.Uniforms["Resolution"]
+	for _, pass := range self.pipeline.passes {
+		size := pass.size(canvas)
+		pass.output = resetImage(pass.output, size)
+		if hasResolution {
+			self.options.Uniforms["Resolution"] = []float32{ float32(size.X), float32(size.Y) }
+		}
+		sources, mappings := self.sourceImages(pass.images, pass.usingImages, canvas)
+		srcBounds := self.linkImages(sources, mappings, &pass.imageAdapters, pass.output.Bounds())
+		self.drawProgramRegion(pass.shader, pass.output, srcBounds)
+	}
+	if hasResolution {
+		self.options.Uniforms["Resolution"] = resolution
+	}
+}
+
+// Returns the image and mapping for an explicit pass image.
+func (self *shaderDisplayer) resolvePassImage(n int, source any, canvas image.Rectangle) (*ebiten.Image, ImageMapping) {
+	switch typedSource := source.(type) {
+	case *ebiten.Image:
+		return typedSource, shaderImageMappings[n]
+	case AutoTexture:
+		return getAutoTexture(typedSource, canvas), shaderImageMappings[n]
+	case PassOutput:
+		return self.pipeline.passes[typedSource].output, MapStretch
+	default:
+		panic("unreachable")
+	}
+}
@@ -1,38 +1,299 @@
-//go:build nope
 package display
 
-import "github.com/hajimehoshi/ebiten/v2"
+import "fmt"
+import "image"
+import "strings"
+import "strconv"
+import "go/ast"
+import "go/token"
+import "go/types"
+import "go/parser"
 
+// A uniform whose value is managed automatically by the displayer,
+// either through on-screen controls or some internal logic.
 type autoUniform interface {
-	Update()
-	Set(*ebiten.DrawTrianglesShaderOptions)
+	Name() string
+	Update(canvas image.Rectangle)
+	Set(uniforms map[string]any)
 }
 
-type autoUniformSet struct {
-	tabPressed bool
-	uniforms []autoUniform
+// A top-level uniform declaration found in a shader program.
+type uniformDecl struct {
+	name string
+	typeName string
+	comment string // line comment after the declaration, without the slashes
+	line int // 1-based
 }
 
-func (self *autoUniformSet) DrawUI(screen *ebiten.Image) {
+// Preprocess a program to extract an autoUniformSet. In the future we may
+// want to modify the program itself, but for the moment we stick to
+// comment-based macros only:
+//   var Radius float // @slider 0..100 default=40
+//   var Offset vec2  // @slider -1..1 step=0.05
+//   var Tint vec4    // @color default=#FF8800 straight
+func preprocess(program []byte) *autoUniformSet {
+	set := newAutoUniformSet()
+	for _, decl := range parseUniformDecls(program) {
+		directive, args, found := parseCommentMacro(decl.comment)
+		if !found { continue }
 
+		var uniform autoUniform
+		var err error
+		switch directive {
+		case "slider":
+			uniform, err = newSliderFromMacro(decl, args)
+		case "color":
+			uniform, err = newColorFromMacro(decl, args)
+		default:
+			panic("unreachable")
+		}
+		if err != nil {
+			warn(fmt.Sprintf("line %d, uniform '%s': %s", decl.line, decl.name, err.Error()))
+			continue
+		}
+		set.uniforms = append(set.uniforms, uniform)
+	}
+	return set
 }
 
-func (self *autoUniformSet) Update() {
-	for i := 0; i < len(self.uniforms); i++ {
-		self.uniforms[i].Update()
+// Finds the top-level 'var' declarations of a program. Kage uses Go
+// syntax, so go/parser can handle it. If the program has syntax errors,
+// we fall back to a line-based scan so comment macros keep working
+// while the shader is being edited.
+func parseUniformDecls(program []byte) []uniformDecl {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", program, parser.ParseComments)
+	if err != nil { return scanUniformDecls(program) }
+
+	var decls []uniformDecl
+	for _, decl := range file.Decls {
+		genDecl, isGenDecl := decl.(*ast.GenDecl)
+		if !isGenDecl || genDecl.Tok != token.VAR { continue }
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			if valueSpec.Type == nil || len(valueSpec.Values) > 0 { continue } // not a uniform
+			typeName := types.ExprString(valueSpec.Type)
+			var comment string
+			if valueSpec.Comment != nil {
+				comment = strings.TrimSpace(valueSpec.Comment.Text())
+			}
+			for _, name := range valueSpec.Names {
+				line := fileSet.Position(name.Pos()).Line
+				decls = append(decls, uniformDecl{ name.Name, typeName, comment, line })
+			}
+		}
 	}
+	return decls
 }
 
-func (self *autoUniformSet) Set(opts *ebiten.DrawTrianglesShaderOptions) {
-	for i := 0; i < len(self.uniforms); i++ {
-		self.uniforms[i].Set(opts)
+// Line-based fallback for parseUniformDecls(). Kage programs are simple
+// enough and uniforms are expected to be declared in a conventional way.
+func scanUniformDecls(program []byte) []uniformDecl {
+	var decls []uniformDecl
+	var depth int // brace depth
+	var inBlockComment bool
+	var inVarGroup bool
+
+	lines := strings.Split(string(program), "\n")
+	for i, line := range lines {
+		// separate code and comments
+		code, comment := line, ""
+		if inBlockComment {
+			end := strings.Index(code, "*/")
+			if end == -1 { continue }
+			code = code[end + 2 : ]
+			inBlockComment = false
+		}
+		for {
+			start := strings.Index(code, "/*")
+			if start == -1 { break }
+			end := strings.Index(code[start + 2 : ], "*/")
+			if end == -1 {
+				code = code[ : start]
+				inBlockComment = true
+				break
+			}
+			code = code[ : start] + " " + code[start + 2 + end + 2 : ]
+		}
+		if index := strings.Index(code, "//"); index != -1 {
+			comment = strings.TrimSpace(code[index + 2 : ])
+			code = code[ : index]
+		}
+		code = strings.TrimSpace(code)
+
+		// parse declarations at the top level only
+		if depth == 0 {
+			switch {
+			case inVarGroup && strings.HasPrefix(code, ")"):
+				inVarGroup = false
+			case inVarGroup:
+				decls = appendUniformDecls(decls, code, comment, i + 1)
+			case strings.HasPrefix(code, "var") && strings.HasSuffix(code, "("):
+				if strings.TrimSpace(code[3 : len(code) - 1]) == "" {
+					inVarGroup = true
+				}
+			case strings.HasPrefix(code, "var "), strings.HasPrefix(code, "var\t"):
+				decls = appendUniformDecls(decls, code[4 : ], comment, i + 1)
+			}
+		}
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
 	}
+
+	return decls
 }
 
-// Preprocess a program to extract an autoUniformSet. In the future we may
-// want to modify the program itself, but for the moment we stick to
-// comment-based macros only.
-func preprocess(program []byte) *autoUniformSet {
-	return nil
-	//stage := "expect-package"
+// Parses a "Name1, Name2 type" declaration and appends the results.
+func appendUniformDecls(decls []uniformDecl, code string, comment string, line int) []uniformDecl {
+	if strings.Contains(code, "=") { return decls } // not a uniform
+	fields := strings.Fields(strings.ReplaceAll(code, ",", " "))
+	if len(fields) < 2 { return decls }
+	typeName := fields[len(fields) - 1]
+	for _, name := range fields[ : len(fields) - 1] {
+		decls = append(decls, uniformDecl{ name, typeName, comment, line })
+	}
+	return decls
+}
+
+// Given a comment like "@slider 0..1 default=0.5", it returns the
+// directive ("slider") and its arguments (["0..1", "default=0.5"]).
+// Directives can appear after other comment text, but only the
+// '@slider' and '@color' keywords are recognized, so comments like
+// "@todo" or email addresses are not mistaken for macros.
+func parseCommentMacro(comment string) (string, []string, bool) {
+	fields := strings.Fields(comment)
+	for i, field := range fields {
+		switch field {
+		case "@slider", "@color":
+			return field[1 : ], fields[i + 1 : ], true
+		}
+	}
+	return "", nil, false
+}
+
+// Returns the number of components and whether they are ints for
+// the given uniform type name. Returns 0 if the type is not supported
+// by the comment macros.
+func uniformTypeComponents(typeName string) (int, bool) {
+	switch typeName {
+	case "float": return 1, false
+	case "vec2" : return 2, false
+	case "vec3" : return 3, false
+	case "vec4" : return 4, false
+	case "int"  : return 1, true
+	case "ivec2": return 2, true
+	case "ivec3": return 3, true
+	case "ivec4": return 4, true
+	default:
+		return 0, false
+	}
+}
+
+// Parses a list of comma separated floats. If only one value is
+// given, it's repeated for all the components.
+func parseMacroFloats(str string, components int) ([]float64, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 1 && len(parts) != components {
+		return nil, fmt.Errorf("expected 1 or %d values, got '%s'", components, str)
+	}
+	values := make([]float64, components)
+	for i := 0; i < components; i++ {
+		part := parts[0]
+		if len(parts) > 1 { part = parts[i] }
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil { return nil, fmt.Errorf("invalid number '%s'", part) }
+		values[i] = value
+	}
+	return values, nil
+}
+
+// Parses a "min..max" range.
+func parseMacroRange(str string) (float64, float64, error) {
+	parts := strings.Split(str, "..")
+	if len(parts) != 2 { return 0, 0, fmt.Errorf("invalid range '%s'", str) }
+	min, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil { return 0, 0, fmt.Errorf("invalid range '%s'", str) }
+	max, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil { return 0, 0, fmt.Errorf("invalid range '%s'", str) }
+	if min >= max { return 0, 0, fmt.Errorf("invalid range '%s' (min >= max)", str) }
+	return min, max, nil
+}
+
+// Parses a "#RRGGBB" or "#RRGGBBAA" hex color into [0, 1] values.
+func parseMacroHexColor(str string) ([]float64, error) {
+	hex := strings.TrimPrefix(str, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid hex color '%s'", str)
+	}
+	rgba := []float64{1, 1, 1, 1}
+	for i := 0; i < len(hex)/2; i++ {
+		value, err := strconv.ParseUint(hex[i*2 : i*2 + 2], 16, 8)
+		if err != nil { return nil, fmt.Errorf("invalid hex color '%s'", str) }
+		rgba[i] = float64(value)/255.0
+	}
+	return rgba, nil
+}
+
+func newSliderFromMacro(decl uniformDecl, args []string) (autoUniform, error) {
+	components, isInt := uniformTypeComponents(decl.typeName)
+	if components == 0 {
+		return nil, fmt.Errorf("@slider can't be used with type '%s'", decl.typeName)
+	}
+
+	var min, max float64 = 0, 1
+	var initial []float64
+	var step float64
+	if isInt { step = 1 }
+	for _, arg := range args {
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "default="):
+			initial, err = parseMacroFloats(arg[8 : ], components)
+		case strings.HasPrefix(arg, "step="):
+			step, err = strconv.ParseFloat(arg[5 : ], 64)
+			if err != nil || step < 0 { err = fmt.Errorf("invalid step '%s'", arg[5 : ]) }
+		case strings.Contains(arg, ".."):
+			min, max, err = parseMacroRange(arg)
+		default:
+			err = fmt.Errorf("unexpected @slider argument '%s'", arg)
+		}
+		if err != nil { return nil, err }
+	}
+	if initial == nil {
+		initial = make([]float64, components)
+		for i, _ := range initial { initial[i] = min }
+	}
+
+	return newUniformSlider(decl.name, components, isInt, min, max, step, initial), nil
+}
+
+func newColorFromMacro(decl uniformDecl, args []string) (autoUniform, error) {
+	if decl.typeName != "vec3" && decl.typeName != "vec4" {
+		return nil, fmt.Errorf("@color can only be used with vec3 or vec4 (got '%s')", decl.typeName)
+	}
+	components, _ := uniformTypeComponents(decl.typeName)
+
+	var options ColorOption
+	if components == 3 { options |= ColorNoAlpha }
+	initial := []float64{1, 1, 1, 1}
+	for _, arg := range args {
+		var err error
+		switch {
+		case strings.HasPrefix(arg, "default=#"):
+			initial, err = parseMacroHexColor(arg[8 : ])
+		case strings.HasPrefix(arg, "default="):
+			var values []float64
+			values, err = parseMacroFloats(arg[8 : ], components)
+			copy(initial, values)
+		case arg == "straight":
+			options |= ColorStraight
+		case arg == "premult":
+			options |= ColorPremult
+		default:
+			err = fmt.Errorf("unexpected @color argument '%s'", arg)
+		}
+		if err != nil { return nil, err }
+	}
+
+	rgba := [4]float64{initial[0], initial[1], initial[2], initial[3]}
+	return newUniformColor(decl.name, rgba, options), nil
 }
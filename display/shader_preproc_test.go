@@ -0,0 +1,28 @@
+package display
+
+import "reflect"
+import "testing"
+
+func TestParseCommentMacro(t *testing.T) {
+	tests := []struct {
+		comment string
+		directive string
+		args []string
+		found bool
+	}{
+		{ "@slider 0..1 default=0.5", "slider", []string{ "0..1", "default=0.5" }, true },
+		{ "speed factor @slider 1..8", "slider", []string{ "1..8" }, true },
+		{ "@color", "color", []string{}, true },
+		{ "@todo tweak this", "", nil, false },
+		{ "ask someone@example.com", "", nil, false },
+		{ "not@slider 0..1", "", nil, false },
+		{ "@sliders 0..1", "", nil, false },
+		{ "", "", nil, false },
+	}
+	for _, test := range tests {
+		directive, args, found := parseCommentMacro(test.comment)
+		if directive != test.directive || found != test.found || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("'%s': got (%q, %q, %t), want (%q, %q, %t)", test.comment, directive, args, found, test.directive, test.args, test.found)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package display
+
+import "os"
+import "fmt"
+import "time"
+import "image"
+import "image/gif"
+import "image/draw"
+import "image/color"
+import "image/color/palette"
+import "errors"
+import "strings"
+import "path/filepath"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+var errRecordingDone = errors.New("recording finished")
+
+var recordPath string
+var recordFrames int = 120
+var recordFPS int = 30
+
+// Sets the options for recordings started with the R key while
+// running a [Shader](). The filename determines the format:
+//  - "*.gif": animated GIF. Colors are limited to a fixed palette
+//    with dithering, and frame delays are rounded to hundredths
+//    of a second.
+//  - "*.png" or "*.apng": animated PNG.
+//  - A filename with a '%d' verb, like "frames/wave_%03d.png":
+//    numbered PNG sequence, starting at 0.
+//
+// If the filename is empty, a timestamped GIF is created on the
+// working directory. Recording stops after the given number of
+// frames, or when R is pressed again.
+//
+// While recording, the Time uniform advances exactly 1/fps seconds
+// per frame, so recordings are reproducible. Uniform infos and other
+// overlays are not recorded.
+//
+// Recordings can also be started from the command line with the
+// --record, --frames and --fps flags, like '--record=out.gif
+// --frames=120 --fps=30'. In this case, the recording starts with
+// Time at zero and the program exits when it's done. These flags
+// take precedence over the values set with this function.
+func SetRecordOptions(filename string, frames, fps int) {
+	if frames < 1 { panic("frames must be strictly positive") }
+	if fps < 1 || fps > 240 { panic("fps must be between 1 and 240") }
+	if filename != "" {
+		_, err := recordFormatFor(filename)
+		if err != nil { panic(err) }
+	}
+	recordPath = filename
+	recordFrames = frames
+	recordFPS = fps
+}
+
+// Returns the recording filename, frames and fps, giving
+// precedence to program flags.
+func getRecordOptions() (string, int, int) {
+	filename, frames, fps := recordPath, recordFrames, recordFPS
+	if argRecordPath != "" { filename = argRecordPath }
+	if argRecordFrames != 0 { frames = argRecordFrames }
+	if argRecordFPS != 0 { fps = argRecordFPS }
+	return filename, frames, fps
+}
+
+type recordFormat uint8
+const (
+	recordGIF recordFormat = iota
+	recordAPNG
+	recordPNGSequence
+)
+
+func recordFormatFor(filename string) (recordFormat, error) {
+	if strings.Contains(filename, "%") {
+		if strings.ToLower(filepath.Ext(filename)) != ".png" {
+			return 0, errors.New("PNG sequence recording filenames must end with .png")
+		}
+		return recordPNGSequence, nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gif": return recordGIF, nil
+	case ".png", ".apng": return recordAPNG, nil
+	default:
+		return 0, errors.New("unsupported recording format for '" + filename + "' (expected .gif, .png or .apng)")
+	}
+}
+
+type frameRecorder struct {
+	filename string
+	format recordFormat
+	maxFrames int
+	fps int
+	count int
+	startTime float64 // value of Time for the first frame
+	exitOnEnd bool // started from the program flags, exits when done or on errors
+	gifAnim *gif.GIF
+	apng *apngEncoder
+}
+
+func newFrameRecorder(filename string, frames, fps int, startTime float64) (*frameRecorder, error) {
+	if filename == "" {
+		timestamp := strings.Replace(time.Now().Format("20060102_150405.000"), ".", "_", 1)
+		filename = "display_record_" + timestamp + ".gif"
+	}
+	format, err := recordFormatFor(filename)
+	if err != nil { return nil, err }
+
+	recorder := &frameRecorder{
+		filename: filename,
+		format: format,
+		maxFrames: frames,
+		fps: fps,
+		startTime: startTime,
+	}
+	switch format {
+	case recordGIF:
+		recorder.gifAnim = &gif.GIF{}
+	case recordAPNG:
+		recorder.apng = &apngEncoder{ fps: fps }
+	case recordPNGSequence:
+		dir := filepath.Dir(fmt.Sprintf(filename, 0))
+		err := os.MkdirAll(dir, 0755)
+		if err != nil { return nil, err }
+	}
+	return recorder, nil
+}
+
+// Returns the value of the Time uniform for the next frame.
+func (self *frameRecorder) Time() float64 {
+	return self.startTime + float64(self.count)/float64(self.fps)
+}
+
+// Returns whether the maximum number of frames has been recorded.
+func (self *frameRecorder) Done() bool {
+	return self.count >= self.maxFrames
+}
+
+func (self *frameRecorder) AddFrame(rgba *image.RGBA) error {
+	switch self.format {
+	case recordGIF:
+		paletted := image.NewPaletted(rgba.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, rgba.Bounds(), rgba, image.Point{})
+		delay := (100 + self.fps/2)/self.fps // hundredths of a second
+		self.gifAnim.Image = append(self.gifAnim.Image, paletted)
+		self.gifAnim.Delay = append(self.gifAnim.Delay, delay)
+	case recordAPNG:
+		err := self.apng.AddFrame(rgba)
+		if err != nil { return err }
+	case recordPNGSequence:
+		err := writePNG(fmt.Sprintf(self.filename, self.count), rgba)
+		if err != nil { return err }
+	default:
+		panic("unreachable")
+	}
+	self.count += 1
+	return nil
+}
+
+// Writes the recording to disk (PNG sequences are written as
+// frames are added, so there's nothing left to do for them).
+func (self *frameRecorder) Finish() error {
+	if self.count == 0 || self.format == recordPNGSequence { return nil }
+
+	file, err := os.Create(self.filename)
+	if err != nil { return err }
+	switch self.format {
+	case recordGIF:
+		err = gif.EncodeAll(file, self.gifAnim)
+	case recordAPNG:
+		err = self.apng.Encode(file)
+	default:
+		panic("unreachable")
+	}
+	if err != nil {
+		file.Close() // ignoring close error
+		return err
+	}
+	return file.Close()
+}
+
+// Starts a recording with the current options, or stops the
+// current one if any.
+func (self *shaderDisplayer) toggleRecording() {
+	if self.recorder != nil {
+		self.finishRecording()
+		return
+	}
+
+	filename, frames, fps := getRecordOptions()
+	recorder, err := newFrameRecorder(filename, frames, fps, self.clock.seconds)
+	if err != nil {
+		fmt.Printf("Failed to start recording: %s\n", err.Error())
+		return
+	}
+	self.recorder = recorder
+	fmt.Printf("Recording %d frames at %dfps to %s (press R to stop)\n", recorder.maxFrames, recorder.fps, recorder.filename)
+}
+
+func (self *shaderDisplayer) finishRecording() {
+	recorder := self.recorder
+	self.recorder = nil
+
+	// continue from the last recorded frame
+	self.clock.Set(recorder.Time())
+
+	err := recorder.Finish()
+	if err != nil {
+		if recorder.exitOnEnd { fail("failed to save recording: " + err.Error()) }
+		fmt.Printf("Failed to save recording: %s\n", err.Error())
+	} else {
+		fmt.Printf("Recorded %d frames to %s\n", recorder.count, recorder.filename)
+	}
+}
+
+// Draws the shader into an offscreen image, adds it to the recording
+// and copies the result to the screen.
+func (self *shaderDisplayer) drawRecordedFrame(screen *ebiten.Image) {
+	bounds := screen.Bounds()
+	if self.recordImage == nil || self.recordImage.Bounds().Size() != bounds.Size() {
+		if self.recordImage != nil { self.recordImage.Dispose() }
+		self.recordImage = ebiten.NewImage(bounds.Dx(), bounds.Dy())
+	}
+	self.drawShader(self.recordImage, bounds)
+	screen.DrawImage(self.recordImage, nil)
+
+	rgba := image.NewRGBA(self.recordImage.Bounds())
+	self.recordImage.ReadPixels(rgba.Pix)
+	err := self.recorder.AddFrame(rgba)
+	if err != nil {
+		// recordings started from the program flags must not
+		// leave the window open forever
+		if self.recorder.exitOnEnd { fail("recording aborted: " + err.Error()) }
+		fmt.Printf("Recording aborted: %s\n", err.Error())
+		self.recorder = nil
+	}
+}
+
+// Draws the recording progress on the top-right corner.
+func (self *shaderDisplayer) drawRecordingInfo(screen *ebiten.Image) {
+	if self.recorder == nil { return }
+	bounds := screen.Bounds()
+	info := fmt.Sprintf("REC %d/%d", self.recorder.count, self.recorder.maxFrames)
+	right := bounds.Max.X - 2
+	if self.autoUniforms.hasWidgets() { // (avoid overlapping the panel)
+		right = self.autoUniforms.panelRect(bounds).Min.X - 4
+	}
+	x := right - len(info)*6 - 6
+	fillRect(screen, image.Rect(x - 2, bounds.Min.Y + 2, right, bounds.Min.Y + 20), color.RGBA{160, 0, 0, 200})
+	ebitenutil.DebugPrintAt(screen, info, x + 2, bounds.Min.Y + 2)
+}
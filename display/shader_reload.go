@@ -0,0 +1,102 @@
+package display
+
+import "os"
+import "fmt"
+import "time"
+import "strings"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// How often we check the shader file for changes.
+const shaderWatchPeriod = 250*time.Millisecond
+
+// Polls a shader file to detect changes. We don't need anything
+// fancier than checking the modification time and size of the
+// file a few times per second.
+type shaderWatcher struct {
+	path string
+	modTime time.Time
+	size int64
+	includes []*shaderWatcher // included files, checked along the main one
+	lastCheck time.Time
+}
+
+func newShaderWatcher(path string) *shaderWatcher {
+	watcher := &shaderWatcher{ path: path, lastCheck: time.Now() }
+	info, err := os.Stat(path)
+	if err == nil {
+		watcher.modTime = info.ModTime()
+		watcher.size = info.Size()
+	}
+	return watcher
+}
+
+// Returns true if the file or any of its includes has changed since
+// the last check. Checks are throttled internally, so this can be
+// called on every tick.
+func (self *shaderWatcher) Changed() bool {
+	now := time.Now()
+	if now.Sub(self.lastCheck) < shaderWatchPeriod { return false }
+	self.lastCheck = now
+
+	changed := self.fileChanged()
+	for _, include := range self.includes {
+		if include.fileChanged() { changed = true }
+	}
+	return changed
+}
+
+// Sets the included files to watch along the main one.
+func (self *shaderWatcher) SetIncludes(paths []string) {
+	self.includes = self.includes[ : 0]
+	for _, path := range paths {
+		self.includes = append(self.includes, newShaderWatcher(path))
+	}
+}
+
+func (self *shaderWatcher) fileChanged() bool {
+	info, err := os.Stat(self.path)
+	if err != nil { return false } // editors may temporarily remove the file on save
+	if info.ModTime().Equal(self.modTime) && info.Size() == self.size {
+		return false
+	}
+	self.modTime = info.ModTime()
+	self.size = info.Size()
+	return true
+}
+
+// Checks the watched shader file and recompiles the shader if
+// it has changed. On failure, the previous shader is preserved.
+func (self *shaderDisplayer) hotReload() {
+	self.reloadProgram(self.watcher, "shader", self.shader, self.setProgram)
+}
+
+// Recompiles the program of the given watcher if its file changed.
+// The name identifies the program on messages, like "shader B". On
+// success, the current shader is disposed and the new shader and
+// expanded program are passed to set. On failure, the current shader
+// is preserved.
+func (self *shaderDisplayer) reloadProgram(watcher *shaderWatcher, name string, current *ebiten.Shader, set func(*ebiten.Shader, []byte)) {
+	if !watcher.Changed() { return }
+
+	programBytes, err := os.ReadFile(watcher.path)
+	if err != nil {
+		self.storeCompileErr("reload", name, err, current != nil)
+		return
+	}
+	if len(programBytes) == 0 { return } // likely a partial write, wait for the next one
+
+	shader, source, err := compileShader(programBytes, watcher.path)
+	if source != nil { watcher.SetIncludes(source.includes) }
+	if err != nil {
+		self.storeCompileErr("reload", name, err, current != nil)
+		return
+	}
+
+	if current != nil { current.Dispose() }
+	set(shader, source.program)
+	if self.compileErr != "" && self.compileErrName == name {
+		fmt.Printf("%s%s reloaded successfully\n", strings.ToUpper(name[ : 1]), name[1 : ])
+		self.compileErr = ""
+	}
+}
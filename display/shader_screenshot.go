@@ -0,0 +1,100 @@
+package display
+
+import "os"
+import "fmt"
+import "time"
+import "image"
+import "image/png"
+import "strings"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+var screenshotScale int = 1
+var screenshotOverlay bool = false
+
+// Sets the options for screenshots taken with the E key while
+// running a [Shader](). By default, only the shader output is
+// exported, at the canvas resolution.
+//
+// The scale can be used to render the shader at a higher resolution
+// for the export, and must be between 1 and 8. Notice that shaders
+// that work with pixel coordinates may look different at different
+// scales. The scale is ignored while recording, as the recorded frame
+// is exported instead. If withOverlay is true, the uniform infos and
+// the uniforms panel will also be included in the screenshot.
+func SetScreenshotOptions(scale int, withOverlay bool) {
+	if scale < 1 || scale > 8 { panic("screenshot scale must be between 1 and 8") }
+	screenshotScale = scale
+	screenshotOverlay = withOverlay
+}
+
+// Draws the shader into an offscreen image at the screenshot scale
+// and copies the result to the screen. Returns the offscreen image.
+func (self *shaderDisplayer) drawScreenshotFrame(screen *ebiten.Image) *ebiten.Image {
+	bounds := screen.Bounds()
+	scale := screenshotScale
+	self.screenshotImage = resetImage(self.screenshotImage, bounds.Size().Mul(scale))
+
+	resolution, hasResolution := self.options.Uniforms["Resolution"]
+	if hasResolution {
+		self.options.Uniforms["Resolution"] = []float32{
+			float32(bounds.Dx()*scale), float32(bounds.Dy()*scale),
+		}
+	}
+	self.drawShader(self.screenshotImage, bounds)
+	if hasResolution {
+		self.options.Uniforms["Resolution"] = resolution
+	}
+
+	opts := &ebiten.DrawImageOptions{}
+	if scale > 1 {
+		opts.GeoM.Scale(1.0/float64(scale), 1.0/float64(scale))
+		opts.Filter = ebiten.FilterLinear
+	}
+	opts.GeoM.Translate(float64(bounds.Min.X), float64(bounds.Min.Y))
+	screen.DrawImage(self.screenshotImage, opts)
+	return self.screenshotImage
+}
+
+// Exports the given shader output to a timestamped PNG file in the
+// working directory, with the overlay on top if requested.
+func (self *shaderDisplayer) exportScreenshot(output *ebiten.Image, canvas image.Rectangle) {
+	scale := output.Bounds().Dx()/canvas.Dx()
+	if scale != screenshotScale { // (recorded frames are reused as they are)
+		fmt.Print("Screenshot scale ignored while recording\n")
+	}
+	if screenshotOverlay {
+		if scale == 1 {
+			self.drawOverlay(output)
+		} else {
+			overlay := ebiten.NewImage(canvas.Dx(), canvas.Dy())
+			defer overlay.Dispose()
+			self.drawOverlay(overlay)
+			opts := &ebiten.DrawImageOptions{}
+			opts.GeoM.Scale(float64(scale), float64(scale))
+			output.DrawImage(overlay, opts)
+		}
+	}
+
+	rgba := image.NewRGBA(output.Bounds())
+	output.ReadPixels(rgba.Pix)
+	timestamp := strings.Replace(time.Now().Format("20060102_150405.000"), ".", "_", 1)
+	filename := "display_shader_" + timestamp + ".png"
+	err := writePNG(filename, rgba)
+	if err != nil {
+		fmt.Printf("Aborted screenshot export: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("Exported screenshot to %s (%dx%d)\n", filename, rgba.Bounds().Dx(), rgba.Bounds().Dy())
+}
+
+func writePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil { return err }
+	err = png.Encode(file, img)
+	if err != nil {
+		file.Close() // ignoring close error
+		return err
+	}
+	return file.Close()
+}
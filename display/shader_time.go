@@ -0,0 +1,136 @@
+package display
+
+import "fmt"
+import "math"
+import "time"
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/inpututil"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+var timeSpeeds = []float64{0.25, 0.5, 1.0, 2.0, 4.0}
+const timeSpeedDefaultIndex = 2
+const timeStep = 1.0/60.0 // seconds per step with period and comma
+var timeControlKeys = []ebiten.Key{
+	ebiten.KeySpace, ebiten.KeyPeriod, ebiten.KeyComma, ebiten.KeyMinus,
+	ebiten.KeyNumpadSubtract, ebiten.KeyEqual, ebiten.KeyNumpadAdd,
+}
+
+// Controls the value of the Time uniform. Time is accumulated
+// instead of taken directly from the wall clock, so it can be
+// paused, stepped, scrubbed and scaled:
+//  - Space: pause or resume.
+//  - Period / comma: step one frame (1/60s) forward / backward.
+//  - Minus / equal: decrease / increase the speed (0.25x to 4x).
+//  - Once any of these is used, the current time and a scrub bar
+//    are shown at the bottom of the canvas.
+type timeControl struct {
+	seconds float64 // current value of Time
+	maxSeconds float64 // highest value of Time seen so far
+	lastAdvance time.Time
+	paused bool
+	speedIndex int
+	scrubbing bool
+	used bool // whether any time control has been used
+}
+
+func newTimeControl() timeControl {
+	return timeControl{ lastAdvance: time.Now(), speedIndex: timeSpeedDefaultIndex }
+}
+
+func (self *timeControl) Speed() float64 {
+	return timeSpeeds[self.speedIndex]
+}
+
+// Sets the current time.
+func (self *timeControl) Set(seconds float64) {
+	self.seconds = math.Max(seconds, 0)
+	self.maxSeconds = math.Max(self.maxSeconds, self.seconds)
+	self.lastAdvance = time.Now()
+}
+
+// Advances the time according to the wall clock and the current
+// speed, and returns the current time.
+func (self *timeControl) Advance() float64 {
+	now := time.Now()
+	if !self.paused && !self.scrubbing {
+		self.seconds += now.Sub(self.lastAdvance).Seconds()*self.Speed()
+		self.maxSeconds = math.Max(self.maxSeconds, self.seconds)
+	}
+	self.lastAdvance = now
+	return self.seconds
+}
+
+// Handles the time control keys and the scrub bar.
+func (self *timeControl) Update(canvas image.Rectangle) {
+	for _, key := range timeControlKeys {
+		if inpututil.IsKeyJustPressed(key) { self.used = true }
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		self.paused = !self.paused
+		self.scrubbing = false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPeriod) {
+		self.paused = true
+		self.Set(self.seconds + timeStep)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyComma) {
+		self.paused = true
+		self.Set(self.seconds - timeStep)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyMinus) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadSubtract) {
+		if self.speedIndex > 0 { self.speedIndex -= 1 }
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyNumpadAdd) {
+		if self.speedIndex < len(timeSpeeds) - 1 { self.speedIndex += 1 }
+	}
+
+	// scrub bar
+	if !self.used || canvas.Empty() { return }
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		self.scrubbing = false
+		return
+	}
+	bar := self.scrubBarRect(canvas)
+	x, y := ebiten.CursorPosition()
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) && image.Pt(x, y).In(bar.Inset(-4)) {
+		self.scrubbing = true
+	}
+	if self.scrubbing {
+		t := clampUnit(float64(x - bar.Min.X)/float64(bar.Dx()))
+		self.seconds = t*self.scrubRange() // (maxSeconds unchanged)
+	}
+}
+
+// Returns the time range covered by the scrub bar, in seconds.
+func (self *timeControl) scrubRange() float64 {
+	return math.Max(10, math.Ceil(self.maxSeconds/5.0)*5.0)
+}
+
+func (self *timeControl) scrubBarRect(canvas image.Rectangle) image.Rectangle {
+	return image.Rect(canvas.Min.X + 8, canvas.Max.Y - 14, canvas.Max.X - 8, canvas.Max.Y - 8)
+}
+
+// Draws the time info and the scrub bar, only once any time
+// control has been used.
+func (self *timeControl) Draw(screen *ebiten.Image) {
+	if !self.used { return }
+
+	bounds := screen.Bounds()
+	info := fmt.Sprintf("Time %.3fs | x%.2f", self.seconds, self.Speed())
+	if self.paused { info += " | paused [Space, '.', ',']" }
+	infoY := bounds.Max.Y - 38
+	fillRect(screen, image.Rect(bounds.Min.X + 4, infoY, bounds.Min.X + 12 + len(info)*6, infoY + 16), panelBackColor)
+	ebitenutil.DebugPrintAt(screen, info, bounds.Min.X + 8, infoY)
+
+	bar := self.scrubBarRect(bounds)
+	fillRect(screen, bar.Inset(-4), panelBackColor)
+	fillRect(screen, bar, panelTrackColor)
+	t := clampUnit(self.seconds/self.scrubRange())
+	fillX := bar.Min.X + int(math.Round(t*float64(bar.Dx())))
+	fillRect(screen, image.Rect(bar.Min.X, bar.Min.Y, fillX, bar.Max.Y), panelFillColor)
+	x := float32(fillX)
+	vector.StrokeLine(screen, x, float32(bar.Min.Y - 3), x, float32(bar.Max.Y + 3), 2, panelHandleColor, false)
+}
@@ -0,0 +1,94 @@
+package display
+
+import "math"
+import "image"
+import "hash/fnv"
+
+type changingUniformID uint8
+const (
+	cuRand changingUniformID = iota
+	cuAngleDeg
+	cuAngleRad
+)
+
+// A float uniform that changes automatically over time. See [URand](),
+// [UAngleDeg]() and [UAngleRad](), and link them with [LinkAutoUniform]().
+//
+// Auto changing uniforms are driven by the 'Time' uniform, so they are
+// consistent with the rest of the shader animation.
+type AutoChangingUniform struct {
+	key changingUniformID
+	hz float32
+}
+
+func checkHz(hz float64) {
+	if hz < 0 {
+		panic("AutoChangingUniform doesn't accept negative hz values")
+	}
+}
+
+// Hz indicate how many times we re-roll the rand per second.
+// For example, 0.1 would mean re-roll once every 10 seconds.
+// The random values are in [0, 1).
+func URand(hz float64) AutoChangingUniform {
+	checkHz(hz)
+	return AutoChangingUniform{ cuRand, float32(hz) }
+}
+
+// Hz indicate how many loops we do per second (from 0 to 360 degrees).
+func UAngleDeg(hz float64) AutoChangingUniform {
+	checkHz(hz)
+	return AutoChangingUniform{ cuAngleDeg, float32(hz) }
+}
+
+// Hz indicate how many loops we do per second (from 0 to 2*pi radians).
+func UAngleRad(hz float64) AutoChangingUniform {
+	checkHz(hz)
+	return AutoChangingUniform{ cuAngleRad, float32(hz) }
+}
+
+// Links a float uniform to a value that changes automatically over
+// time. For example:
+//   display.LinkAutoUniform("Seed", display.URand(0.5))
+//   display.LinkAutoUniform("Angle", display.UAngleRad(0.25))
+func LinkAutoUniform(name string, uniform AutoChangingUniform) {
+	assertNotBuiltinUniform(name)
+	linkAutoUniform(&changingUniform{ name: name, AutoChangingUniform: uniform })
+}
+
+type changingUniform struct {
+	AutoChangingUniform
+	name string
+}
+
+func (self *changingUniform) Name() string { return self.name }
+func (self *changingUniform) Update(image.Rectangle) {}
+
+func (self *changingUniform) Set(uniforms map[string]any) {
+	seconds, _ := uniforms["Time"].(float32)
+	cycles := float64(seconds)*float64(self.hz)
+	switch self.key {
+	case cuRand:
+		uniforms[self.name] = self.randAt(int64(math.Floor(cycles)))
+	case cuAngleDeg:
+		uniforms[self.name] = float32(fract(cycles)*360.0)
+	case cuAngleRad:
+		uniforms[self.name] = float32(fract(cycles)*2.0*math.Pi)
+	default:
+		panic("unreachable")
+	}
+}
+
+// Returns a pseudo-random value in [0, 1) for the given period. The
+// value only depends on the period and the uniform name, so pausing
+// or rewinding time gives back the same values.
+func (self *changingUniform) randAt(period int64) float32 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(self.name))
+	x := mix64(hash.Sum64() ^ uint64(period))
+	return float32(x >> 40)/float32(1 << 24)
+}
+
+func fract(x float64) float64 {
+	return x - math.Floor(x)
+}
@@ -0,0 +1,372 @@
+package display
+
+import "fmt"
+import "math"
+import "image"
+import "image/color"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+type ColorOption uint8
+const (
+	ColorPremult  ColorOption = 0b0001 // write premultiplied alpha values (default)
+	ColorStraight ColorOption = 0b0010 // write straight alpha values
+	ColorNoAlpha  ColorOption = 0b0100 // write a vec3 instead of a vec4, no alpha editing
+)
+
+// Links a vec4 uniform to an on-screen color picker, which can work
+// in RGB or HSV mode (click the picker's label to switch). Like sliders,
+// color pickers are shown on a panel at the right side of the screen,
+// which can be toggled with Tab.
+//
+// By default, the uniform values are written with premultiplied alpha,
+// like Ebitengine uses everywhere else. You can pass [ColorStraight] to
+// change that, or [ColorNoAlpha] to work with a vec3 uniform instead.
+//
+// Color pickers can also be declared directly on the shader with comment
+// macros, like 'var Tint vec4 // @color default=#FF8800 straight'.
+func LinkUniformColor(name string, initial color.Color, options ...ColorOption) {
+	assertNotBuiltinUniform(name)
+	if initial == nil { panic("can't link uniform color with nil initial color") }
+
+	var optsSeen ColorOption
+	for _, opt := range options {
+		if optsSeen & opt != 0 {
+			warn("repeated color option in LinkUniformColor()")
+		}
+		optsSeen = optsSeen | opt
+	}
+	if optsSeen & ColorPremult != 0 && optsSeen & ColorStraight != 0 {
+		panic("can't use both display.ColorPremult and display.ColorStraight")
+	}
+
+	nrgba := color.NRGBAModel.Convert(initial).(color.NRGBA)
+	rgba := [4]float64{
+		float64(nrgba.R)/255.0, float64(nrgba.G)/255.0,
+		float64(nrgba.B)/255.0, float64(nrgba.A)/255.0,
+	}
+	linkAutoUniform(newUniformColor(name, rgba, optsSeen))
+}
+
+// Color picker layout constants.
+const (
+	colorLabelHeight = 16
+	colorSquareHeight = 48
+	colorBarHeight = 6
+	colorBarSpacing = 4
+)
+
+// Parts of a color picker that can be dragged.
+const (
+	colorPartNone = iota
+	colorPartSV
+	colorPartHue
+	colorPartR
+	colorPartG
+	colorPartB
+	colorPartA
+)
+
+// An on-screen color picker for vec3 and vec4 uniforms.
+type uniformColor struct {
+	name string
+	rgba [4]float64 // straight alpha
+	hsv [3]float64 // kept in sync with rgba, but preserves hue on grays
+	straight bool
+	noAlpha bool
+	hsvMode bool
+	dragPart int
+}
+
+func newUniformColor(name string, rgba [4]float64, options ColorOption) *uniformColor {
+	picker := &uniformColor{
+		name: name,
+		straight: options & ColorStraight != 0,
+		noAlpha: options & ColorNoAlpha != 0,
+	}
+	if picker.noAlpha { rgba[3] = 1.0 }
+	picker.setRGBA(rgba)
+	return picker
+}
+
+func (self *uniformColor) Name() string { return self.name }
+func (self *uniformColor) Update(image.Rectangle) {}
+
+func (self *uniformColor) Set(uniforms map[string]any) {
+	r, g, b, a := float32(self.rgba[0]), float32(self.rgba[1]), float32(self.rgba[2]), float32(self.rgba[3])
+	if !self.straight { r, g, b = r*a, g*a, b*a }
+	if self.noAlpha {
+		uniforms[self.name] = []float32{r, g, b}
+	} else {
+		uniforms[self.name] = []float32{r, g, b, a}
+	}
+}
+
+func (self *uniformColor) inherit(prev autoUniform) {
+	prevColor, ok := prev.(*uniformColor)
+	if !ok { return }
+	rgba := prevColor.rgba
+	if self.noAlpha { rgba[3] = 1.0 }
+	self.setRGBA(rgba)
+	self.hsv[0] = prevColor.hsv[0]
+	self.hsvMode = prevColor.hsvMode
+}
+
+func (self *uniformColor) setRGBA(rgba [4]float64) {
+	self.rgba = rgba
+	hue := self.hsv[0]
+	self.hsv[0], self.hsv[1], self.hsv[2] = rgbToHSV(rgba[0], rgba[1], rgba[2])
+	if self.hsv[1] == 0 || self.hsv[2] == 0 { self.hsv[0] = hue } // keep hue on grays
+}
+
+func (self *uniformColor) setHSV(h, s, v float64) {
+	self.hsv = [3]float64{h, s, v}
+	self.rgba[0], self.rgba[1], self.rgba[2] = hsvToRGB(h, s, v)
+}
+
+func (self *uniformColor) WidgetHeight() int {
+	height := colorLabelHeight
+	if self.hsvMode {
+		height += colorSquareHeight + colorBarSpacing + colorBarHeight + colorBarSpacing
+	} else {
+		height += 3*(colorBarHeight + colorBarSpacing)
+	}
+	if !self.noAlpha { height += colorBarHeight + colorBarSpacing }
+	return height
+}
+
+// Returns the picker parts and their rects, in layout order.
+func (self *uniformColor) parts(rect image.Rectangle) ([]int, []image.Rectangle) {
+	var parts []int
+	var rects []image.Rectangle
+	y := rect.Min.Y + colorLabelHeight
+	addPart := func(part int, height int) {
+		parts = append(parts, part)
+		rects = append(rects, image.Rect(rect.Min.X, y, rect.Max.X, y + height))
+		y += height + colorBarSpacing
+	}
+
+	if self.hsvMode {
+		addPart(colorPartSV, colorSquareHeight)
+		addPart(colorPartHue, colorBarHeight)
+	} else {
+		addPart(colorPartR, colorBarHeight)
+		addPart(colorPartG, colorBarHeight)
+		addPart(colorPartB, colorBarHeight)
+	}
+	if !self.noAlpha { addPart(colorPartA, colorBarHeight) }
+	return parts, rects
+}
+
+func (self *uniformColor) Drag(rect image.Rectangle, x, y int, start bool) bool {
+	parts, rects := self.parts(rect)
+	if start {
+		// clicking the label switches between RGB and HSV modes
+		if y < rect.Min.Y + colorLabelHeight {
+			self.hsvMode = !self.hsvMode
+			return false
+		}
+
+		self.dragPart = colorPartNone
+		for i, partRect := range rects {
+			if y < partRect.Max.Y + colorBarSpacing {
+				self.dragPart = parts[i]
+				break
+			}
+		}
+	}
+
+	var partRect image.Rectangle
+	for i, part := range parts {
+		if part == self.dragPart { partRect = rects[i] }
+	}
+	if partRect.Empty() { return false }
+	tx := clampUnit(float64(x - partRect.Min.X)/float64(partRect.Dx()))
+	ty := clampUnit(float64(y - partRect.Min.Y)/float64(partRect.Dy()))
+
+	rgba := self.rgba
+	switch self.dragPart {
+	case colorPartSV : self.setHSV(self.hsv[0], tx, 1.0 - ty)
+	case colorPartHue: self.setHSV(tx*360.0, self.hsv[1], self.hsv[2])
+	case colorPartR  : rgba[0] = tx ; self.setRGBA(rgba)
+	case colorPartG  : rgba[1] = tx ; self.setRGBA(rgba)
+	case colorPartB  : rgba[2] = tx ; self.setRGBA(rgba)
+	case colorPartA  : self.rgba[3] = tx
+	}
+	return true
+}
+
+func (self *uniformColor) DrawWidget(screen *ebiten.Image, rect image.Rectangle) {
+	// label and swatch
+	mode := "[RGB]"
+	if self.hsvMode { mode = "[HSV]" }
+	label := fmt.Sprintf("%s %s %s", self.name, mode, self.valueStr())
+	ebitenutil.DebugPrintAt(screen, label, rect.Min.X, rect.Min.Y)
+	size := colorLabelHeight - 4
+	swatchRect := image.Rect(rect.Max.X - size, rect.Min.Y + 2, rect.Max.X, rect.Min.Y + 2 + size)
+	drawCheckerRect(screen, swatchRect)
+	r, g, b, a := self.rgba[0], self.rgba[1], self.rgba[2], self.rgba[3]
+	fillRect(screen, swatchRect, color.NRGBA{toU8(r), toU8(g), toU8(b), toU8(a)})
+
+	// parts
+	opaque := func(r, g, b float64) color.Color { return color.NRGBA{toU8(r), toU8(g), toU8(b), 255} }
+	parts, rects := self.parts(rect)
+	for i, part := range parts {
+		partRect := rects[i]
+		var t float64
+		switch part {
+		case colorPartSV:
+			hr, hg, hb := hsvToRGB(self.hsv[0], 1, 1)
+			drawGradientRect(screen, partRect, color.White, opaque(hr, hg, hb), true)
+			drawGradientRect(screen, partRect, color.Transparent, color.Black, false)
+			cx := float32(partRect.Min.X) + float32(self.hsv[1])*float32(partRect.Dx())
+			cy := float32(partRect.Min.Y) + float32(1.0 - self.hsv[2])*float32(partRect.Dy())
+			vector.StrokeCircle(screen, cx, cy, 3, 1, panelHandleColor, true)
+			continue
+		case colorPartHue:
+			segWidth := float64(partRect.Dx())/6.0
+			for seg := 0; seg < 6; seg++ {
+				r0, g0, b0 := hsvToRGB(float64(seg)*60.0, 1, 1)
+				r1, g1, b1 := hsvToRGB(float64(seg + 1)*60.0, 1, 1)
+				x0 := partRect.Min.X + int(math.Round(float64(seg)*segWidth))
+				x1 := partRect.Min.X + int(math.Round(float64(seg + 1)*segWidth))
+				segRect := image.Rect(x0, partRect.Min.Y, x1, partRect.Max.Y)
+				drawGradientRect(screen, segRect, opaque(r0, g0, b0), opaque(r1, g1, b1), true)
+			}
+			t = self.hsv[0]/360.0
+		case colorPartR:
+			drawGradientRect(screen, partRect, opaque(0, g, b), opaque(1, g, b), true)
+			t = r
+		case colorPartG:
+			drawGradientRect(screen, partRect, opaque(r, 0, b), opaque(r, 1, b), true)
+			t = g
+		case colorPartB:
+			drawGradientRect(screen, partRect, opaque(r, g, 0), opaque(r, g, 1), true)
+			t = b
+		case colorPartA:
+			drawCheckerRect(screen, partRect)
+			drawGradientRect(screen, partRect, color.Transparent, opaque(r, g, b), true)
+			t = a
+		}
+		x := float32(partRect.Min.X) + float32(t)*float32(partRect.Dx())
+		vector.DrawFilledRect(screen, x - 1, float32(partRect.Min.Y - 1), 2, float32(partRect.Dy() + 2), panelHandleColor, false)
+	}
+}
+
+func (self *uniformColor) valueStr() string {
+	if self.hsvMode {
+		str := fmt.Sprintf("H%d S%d V%d", int(math.Round(self.hsv[0])), int(math.Round(self.hsv[1]*100)), int(math.Round(self.hsv[2]*100)))
+		if self.noAlpha { return str }
+		return str + fmt.Sprintf(" A%d", toU8(self.rgba[3]))
+	}
+	str := fmt.Sprintf("R%d G%d B%d", toU8(self.rgba[0]), toU8(self.rgba[1]), toU8(self.rgba[2]))
+	if self.noAlpha { return str }
+	return str + fmt.Sprintf(" A%d", toU8(self.rgba[3]))
+}
+
+// --- color helpers ---
+
+func clampUnit(value float64) float64 {
+	return math.Max(0, math.Min(value, 1))
+}
+
+func toU8(value float64) uint8 {
+	return uint8(math.Round(clampUnit(value)*255))
+}
+
+// Hue in [0, 360], saturation and value in [0, 1].
+func rgbToHSV(r, g, b float64) (float64, float64, float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	delta := max - min
+
+	var h, s float64
+	if max > 0 { s = delta/max }
+	if delta > 0 {
+		switch max {
+		case r: h = 60.0*math.Mod((g - b)/delta, 6)
+		case g: h = 60.0*((b - r)/delta + 2)
+		default: h = 60.0*((r - g)/delta + 4)
+		}
+		if h < 0 { h += 360.0 }
+	}
+	return h, s, max
+}
+
+// Hue in [0, 360], saturation and value in [0, 1].
+func hsvToRGB(h, s, v float64) (float64, float64, float64) {
+	h = math.Mod(h, 360.0)
+	if h < 0 { h += 360.0 }
+	c := v*s
+	x := c*(1 - math.Abs(math.Mod(h/60.0, 2) - 1))
+	m := v - c
+	var r, g, b float64
+	switch {
+	case h <  60: r, g, b = c, x, 0
+	case h < 120: r, g, b = x, c, 0
+	case h < 180: r, g, b = 0, c, x
+	case h < 240: r, g, b = 0, x, c
+	case h < 300: r, g, b = x, 0, c
+	default:      r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// --- drawing helpers ---
+
+var whitePixel *ebiten.Image
+
+func getWhitePixel() *ebiten.Image {
+	if whitePixel == nil {
+		img := ebiten.NewImage(3, 3)
+		img.Fill(color.White)
+		whitePixel = img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+	}
+	return whitePixel
+}
+
+func fillRect(screen *ebiten.Image, rect image.Rectangle, clr color.Color) {
+	vector.DrawFilledRect(screen, float32(rect.Min.X), float32(rect.Min.Y), float32(rect.Dx()), float32(rect.Dy()), clr, false)
+}
+
+// Draws a rect with a horizontal (left to right) or vertical (top to
+// bottom) gradient between the two given colors.
+func drawGradientRect(screen *ebiten.Image, rect image.Rectangle, from, to color.Color, horizontal bool) {
+	var vertices [4]ebiten.Vertex
+	xl, xr, yt, yb := RectToF32(rect)
+	PositionRectVertices(&vertices, 1, 2, 1, 2, xl, xr, yt, yb)
+	fr, fg, fb, fa := from.RGBA()
+	tr, tg, tb, ta := to.RGBA()
+	setColor := func(vertex *ebiten.Vertex, r, g, b, a uint32) {
+		vertex.ColorR = float32(r)/65535.0 // (premultiplied)
+		vertex.ColorG = float32(g)/65535.0
+		vertex.ColorB = float32(b)/65535.0
+		vertex.ColorA = float32(a)/65535.0
+	}
+	setColor(&vertices[0], fr, fg, fb, fa)
+	setColor(&vertices[3], tr, tg, tb, ta)
+	if horizontal {
+		setColor(&vertices[1], tr, tg, tb, ta)
+		setColor(&vertices[2], fr, fg, fb, fa)
+	} else {
+		setColor(&vertices[1], fr, fg, fb, fa)
+		setColor(&vertices[2], tr, tg, tb, ta)
+	}
+	screen.DrawTriangles(vertices[ : ], []uint16{0, 1, 2, 1, 2, 3}, getWhitePixel(), nil)
+}
+
+// Draws a small checkerboard pattern, useful as a background for
+// translucent colors.
+func drawCheckerRect(screen *ebiten.Image, rect image.Rectangle) {
+	const cellSize = 4
+	fillRect(screen, rect, color.RGBA{200, 200, 200, 255})
+	for y := rect.Min.Y; y < rect.Max.Y; y += cellSize {
+		for x := rect.Min.X; x < rect.Max.X; x += cellSize {
+			if ((x - rect.Min.X)/cellSize + (y - rect.Min.Y)/cellSize) % 2 == 0 { continue }
+			cell := image.Rect(x, y, x + cellSize, y + cellSize).Intersect(rect)
+			fillRect(screen, cell, color.RGBA{128, 128, 128, 255})
+		}
+	}
+}
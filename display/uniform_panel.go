@@ -0,0 +1,204 @@
+package display
+
+import "image"
+import "image/color"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+// Uniform panel layout constants.
+const (
+	panelWidth   = 220
+	panelMargin  = 4
+	panelPadding = 6
+	panelHeaderHeight = 18
+	panelWidgetSpacing = 6
+)
+
+var (
+	panelBackColor   = color.RGBA{ 16,  16,  16, 200}
+	panelTrackColor  = color.RGBA{ 64,  64,  64, 255}
+	panelFillColor   = color.RGBA{128, 160, 200, 255}
+	panelHandleColor = color.RGBA{255, 255, 255, 255}
+)
+
+// An autoUniform that can also be controlled through the on-screen
+// uniform panel.
+type uniformWidget interface {
+	autoUniform
+
+	// Height that the widget will take on the panel, in pixels.
+	WidgetHeight() int
+
+	// Called when the mouse is pressed within the widget's rect,
+	// and then on every tick while the drag continues. Returns
+	// whether the widget wants to keep the drag going.
+	Drag(rect image.Rectangle, x, y int, start bool) bool
+
+	// Draws the widget within the given rect.
+	DrawWidget(screen *ebiten.Image, rect image.Rectangle)
+}
+
+// Auto uniforms linked explicitly from Go code, as opposed to
+// the ones declared through comment macros.
+var linkedAutoUniforms []autoUniform
+
+// Links an auto uniform, replacing any previous one with the same name.
+func linkAutoUniform(uniform autoUniform) {
+	for i, linked := range linkedAutoUniforms {
+		if linked.Name() == uniform.Name() {
+			linkedAutoUniforms[i] = uniform
+			return
+		}
+	}
+	linkedAutoUniforms = append(linkedAutoUniforms, uniform)
+}
+
+// A set of auto uniforms, which includes the on-screen uniform panel
+// where their widgets are displayed. The panel is toggled with Tab.
+type autoUniformSet struct {
+	tabPressed bool
+	collapsed bool
+	uniforms []autoUniform
+	dragIndex int // index of the widget being dragged, or -1
+}
+
+func newAutoUniformSet() *autoUniformSet {
+	return &autoUniformSet{ dragIndex: -1 }
+}
+
+// Adds the given uniforms, skipping any whose name is already
+// present on the set, and returns the set itself.
+func (self *autoUniformSet) Add(uniforms ...autoUniform) *autoUniformSet {
+	for _, uniform := range uniforms {
+		if self.contains(uniform.Name()) { continue }
+		self.uniforms = append(self.uniforms, uniform)
+	}
+	self.dragIndex = -1
+	return self
+}
+
+func (self *autoUniformSet) contains(name string) bool {
+	for _, uniform := range self.uniforms {
+		if uniform.Name() == name { return true }
+	}
+	return false
+}
+
+// Copies the current values of the uniforms that also exist on
+// the previous set, so they are preserved when reloading shaders.
+func (self *autoUniformSet) Inherit(prev *autoUniformSet) {
+	if prev == nil { return }
+	for _, uniform := range self.uniforms {
+		inheritor, ok := uniform.(interface{ inherit(autoUniform) })
+		if !ok { continue }
+		for _, prevUniform := range prev.uniforms {
+			if prevUniform.Name() == uniform.Name() {
+				inheritor.inherit(prevUniform)
+				break
+			}
+		}
+	}
+}
+
+func (self *autoUniformSet) hasWidgets() bool {
+	for _, uniform := range self.uniforms {
+		if _, isWidget := uniform.(uniformWidget); isWidget { return true }
+	}
+	return false
+}
+
+// Updates the uniforms and handles the panel input. The bounds are
+// the bounds of the canvas where the panel is drawn.
+func (self *autoUniformSet) Update(bounds image.Rectangle) {
+	for i := 0; i < len(self.uniforms); i++ {
+		self.uniforms[i].Update(bounds)
+	}
+	if !self.hasWidgets() { return }
+
+	// toggle panel
+	tabPressed := ebiten.IsKeyPressed(ebiten.KeyTab)
+	if tabPressed != self.tabPressed {
+		if !self.tabPressed {
+			self.collapsed = !self.collapsed
+			self.dragIndex = -1
+		}
+		self.tabPressed = tabPressed
+	}
+	if self.collapsed { return }
+
+	// handle widget dragging
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		self.dragIndex = -1
+		return
+	}
+	x, y := ebiten.CursorPosition()
+	justPressed := self.dragIndex == -1
+	self.eachWidget(bounds, func(index int, widget uniformWidget, rect image.Rectangle) {
+		if justPressed {
+			if !image.Pt(x, y).In(rect) { return }
+			if widget.Drag(rect, x, y, true) { self.dragIndex = index }
+		} else if index == self.dragIndex {
+			if !widget.Drag(rect, x, y, false) { self.dragIndex = -1 }
+		}
+	})
+	if justPressed && self.dragIndex == -1 {
+		self.dragIndex = -2 // pressed outside widgets, ignore until release
+	}
+}
+
+// Writes the values of all the uniforms to the given map.
+func (self *autoUniformSet) Set(uniforms map[string]any) {
+	for i := 0; i < len(self.uniforms); i++ {
+		self.uniforms[i].Set(uniforms)
+	}
+}
+
+// Draws the uniform panel on the right side of the screen.
+func (self *autoUniformSet) DrawUI(screen *ebiten.Image) {
+	if !self.hasWidgets() { return }
+
+	bounds := screen.Bounds()
+	panelRect := self.panelRect(bounds)
+	vector.DrawFilledRect(
+		screen, float32(panelRect.Min.X), float32(panelRect.Min.Y),
+		float32(panelRect.Dx()), float32(panelRect.Dy()), panelBackColor, false,
+	)
+	if self.collapsed {
+		ebitenutil.DebugPrintAt(screen, "[Tab] show uniforms", panelRect.Min.X + panelPadding, panelRect.Min.Y + 1)
+		return
+	}
+
+	ebitenutil.DebugPrintAt(screen, "[Tab] hide uniforms", panelRect.Min.X + panelPadding, panelRect.Min.Y + 1)
+	self.eachWidget(bounds, func(_ int, widget uniformWidget, rect image.Rectangle) {
+		widget.DrawWidget(screen, rect)
+	})
+}
+
+func (self *autoUniformSet) panelRect(bounds image.Rectangle) image.Rectangle {
+	minX := bounds.Max.X - panelWidth - panelMargin
+	minY := bounds.Min.Y + panelMargin
+	height := panelHeaderHeight
+	if !self.collapsed {
+		for _, uniform := range self.uniforms {
+			widget, isWidget := uniform.(uniformWidget)
+			if !isWidget { continue }
+			height += widget.WidgetHeight() + panelWidgetSpacing
+		}
+	}
+	return image.Rect(minX, minY, minX + panelWidth, minY + height)
+}
+
+func (self *autoUniformSet) eachWidget(bounds image.Rectangle, fn func(int, uniformWidget, image.Rectangle)) {
+	panelRect := self.panelRect(bounds)
+	y := panelRect.Min.Y + panelHeaderHeight
+	for i, uniform := range self.uniforms {
+		widget, isWidget := uniform.(uniformWidget)
+		if !isWidget { continue }
+		height := widget.WidgetHeight()
+		rect := image.Rect(panelRect.Min.X + panelPadding, y, panelRect.Max.X - panelPadding, y + height)
+		fn(i, widget, rect)
+		y += height + panelWidgetSpacing
+	}
+}
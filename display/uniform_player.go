@@ -0,0 +1,120 @@
+package display
+
+import "math"
+import "image"
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// Gamepad sticks below this value are considered idle.
+const gamepadDeadZone = 0.2
+
+// Links a vec2 uniform to a simulated player position that can be
+// moved with WASD, the arrow keys or a gamepad (left stick or d-pad).
+// The speed is given in pixels per second, and the position is kept
+// within the given bounds (in canvas pixels). If the bounds are empty,
+// the canvas bounds are used instead. The player starts at the center
+// of the bounds.
+//
+// Up to two additional uniform names can be passed: the first one will
+// be used for a vec2 with the current velocity (in pixels per second),
+// and the second one for a normalized vec2 with the last non-zero
+// movement direction (the facing direction). Empty names are ignored.
+//
+// Example:
+//   display.LinkPlayerPos("Player", 160, image.Rectangle{}, "", "Facing")
+func LinkPlayerPos(name string, speed float64, bounds image.Rectangle, names ...string) {
+	assertNotBuiltinUniform(name)
+	if len(names) > 2 {
+		panic("LinkPlayerPos() doesn't accept more than two extra uniform names: velocity, facing")
+	}
+	if speed <= 0 { panic("LinkPlayerPos() requires a positive speed") }
+
+	player := &playerUniform{ name: name, speed: speed, bounds: bounds, facing: [2]float64{1, 0} }
+	if len(names) > 0 { player.velocityName = names[0] }
+	if len(names) > 1 { player.facingName = names[1] }
+	if player.velocityName != "" { assertNotBuiltinUniform(player.velocityName) }
+	if player.facingName != "" { assertNotBuiltinUniform(player.facingName) }
+	linkAutoUniform(player)
+}
+
+type playerUniform struct {
+	name string
+	velocityName string
+	facingName string
+	speed float64
+	bounds image.Rectangle // empty to use the canvas bounds
+	initialized bool
+	position [2]float64
+	velocity [2]float64
+	facing [2]float64
+}
+
+func (self *playerUniform) Name() string { return self.name }
+
+func (self *playerUniform) Update(canvas image.Rectangle) {
+	bounds := self.bounds
+	if bounds.Empty() { bounds = canvas }
+	if bounds.Empty() { return } // canvas not known yet
+	if !self.initialized {
+		self.position[0] = float64(bounds.Min.X + bounds.Max.X)/2.0
+		self.position[1] = float64(bounds.Min.Y + bounds.Max.Y)/2.0
+		self.initialized = true
+	}
+
+	// get input direction and normalize it if necessary
+	dx, dy := playerInputDirection()
+	length := math.Hypot(dx, dy)
+	if length > 1.0 {
+		dx, dy = dx/length, dy/length
+	}
+	if length > 0 {
+		self.facing = [2]float64{ dx/length, dy/length }
+	}
+
+	// integrate position
+	tps := float64(ebiten.TPS())
+	if tps <= 0 { tps = 60 } // (ebiten.SyncWithFPS)
+	self.velocity = [2]float64{ dx*self.speed, dy*self.speed }
+	self.position[0] += self.velocity[0]/tps
+	self.position[1] += self.velocity[1]/tps
+	self.position[0] = math.Max(float64(bounds.Min.X), math.Min(self.position[0], float64(bounds.Max.X)))
+	self.position[1] = math.Max(float64(bounds.Min.Y), math.Min(self.position[1], float64(bounds.Max.Y)))
+}
+
+func (self *playerUniform) Set(uniforms map[string]any) {
+	uniforms[self.name] = []float32{ float32(self.position[0]), float32(self.position[1]) }
+	if self.velocityName != "" {
+		uniforms[self.velocityName] = []float32{ float32(self.velocity[0]), float32(self.velocity[1]) }
+	}
+	if self.facingName != "" {
+		uniforms[self.facingName] = []float32{ float32(self.facing[0]), float32(self.facing[1]) }
+	}
+}
+
+// Returns the movement direction from keyboard and gamepads. The
+// components are in [-1, 1], but the vector is not normalized.
+func playerInputDirection() (float64, float64) {
+	var dx, dy float64
+	if ebiten.IsKeyPressed(ebiten.KeyA) || ebiten.IsKeyPressed(ebiten.KeyArrowLeft ) { dx -= 1 }
+	if ebiten.IsKeyPressed(ebiten.KeyD) || ebiten.IsKeyPressed(ebiten.KeyArrowRight) { dx += 1 }
+	if ebiten.IsKeyPressed(ebiten.KeyW) || ebiten.IsKeyPressed(ebiten.KeyArrowUp   ) { dy -= 1 }
+	if ebiten.IsKeyPressed(ebiten.KeyS) || ebiten.IsKeyPressed(ebiten.KeyArrowDown ) { dy += 1 }
+	if dx != 0 || dy != 0 { return dx, dy }
+
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if !ebiten.IsStandardGamepadLayoutAvailable(id) {
+			dx = ebiten.GamepadAxisValue(id, 0)
+			dy = ebiten.GamepadAxisValue(id, 1)
+		} else {
+			dx = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+			dy = ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+			if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftLeft  ) { dx = -1 }
+			if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftRight ) { dx = +1 }
+			if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftTop   ) { dy = -1 }
+			if ebiten.IsStandardGamepadButtonPressed(id, ebiten.StandardGamepadButtonLeftBottom) { dy = +1 }
+		}
+		if math.Hypot(dx, dy) < gamepadDeadZone { continue }
+		return dx, dy
+	}
+	return 0, 0
+}
@@ -0,0 +1,170 @@
+package display
+
+import "fmt"
+import "math"
+import "image"
+import "strings"
+
+import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/hajimehoshi/ebiten/v2/vector"
+import "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+// Links a float uniform to an on-screen slider. Sliders are shown
+// on a panel at the right side of the screen, which can be toggled
+// with Tab. Linking the same name again replaces the previous slider.
+//
+// Sliders can also be declared directly on the shader with comment
+// macros, like 'var Radius float // @slider 0..100 default=40'.
+func LinkUniformSlider(name string, min, max, initial float64) {
+	linkSlider(name, 1, false, min, max, initial)
+}
+
+// Like [LinkUniformSlider](), but for int uniforms.
+func LinkUniformSliderInt(name string, min, max, initial int) {
+	linkSlider(name, 1, true, float64(min), float64(max), float64(initial))
+}
+
+// Like [LinkUniformSlider](), but for vec2 uniforms.
+func LinkUniformSlider2(name string, min, max, initialX, initialY float64) {
+	linkSlider(name, 2, false, min, max, initialX, initialY)
+}
+
+// Like [LinkUniformSlider](), but for vec3 uniforms.
+func LinkUniformSlider3(name string, min, max, initialX, initialY, initialZ float64) {
+	linkSlider(name, 3, false, min, max, initialX, initialY, initialZ)
+}
+
+// Like [LinkUniformSlider](), but for vec4 uniforms.
+func LinkUniformSlider4(name string, min, max, initialX, initialY, initialZ, initialW float64) {
+	linkSlider(name, 4, false, min, max, initialX, initialY, initialZ, initialW)
+}
+
+func linkSlider(name string, components int, isInt bool, min, max float64, initial ...float64) {
+	assertNotBuiltinUniform(name)
+	if min >= max {
+		panic(fmt.Sprintf("slider for '%s' has min >= max (%f, %f)", name, min, max))
+	}
+	var step float64
+	if isInt { step = 1 }
+	linkAutoUniform(newUniformSlider(name, components, isInt, min, max, step, initial))
+}
+
+// Slider layout constants.
+const (
+	sliderLabelHeight = 16
+	sliderBarHeight = 6
+	sliderBarSpacing = 4
+)
+
+// An on-screen slider for float, int and vector uniforms, with one
+// bar per component.
+type uniformSlider struct {
+	name string
+	values []float64
+	min, max float64
+	step float64 // 0 for continuous values
+	isInt bool
+	dragComponent int
+}
+
+func newUniformSlider(name string, components int, isInt bool, min, max, step float64, initial []float64) *uniformSlider {
+	slider := &uniformSlider{
+		name: name,
+		values: make([]float64, components),
+		min: min, max: max, step: step,
+		isInt: isInt,
+	}
+	for i := 0; i < components; i++ {
+		slider.values[i] = slider.quantize(initial[i])
+	}
+	return slider
+}
+
+func (self *uniformSlider) Name() string { return self.name }
+func (self *uniformSlider) Update(image.Rectangle) {}
+
+func (self *uniformSlider) Set(uniforms map[string]any) {
+	if self.isInt {
+		if len(self.values) == 1 {
+			uniforms[self.name] = int(math.Round(self.values[0]))
+		} else {
+			ints := make([]int, len(self.values))
+			for i, value := range self.values { ints[i] = int(math.Round(value)) }
+			uniforms[self.name] = ints
+		}
+	} else {
+		if len(self.values) == 1 {
+			uniforms[self.name] = float32(self.values[0])
+		} else {
+			floats := make([]float32, len(self.values))
+			for i, value := range self.values { floats[i] = float32(value) }
+			uniforms[self.name] = floats
+		}
+	}
+}
+
+func (self *uniformSlider) inherit(prev autoUniform) {
+	prevSlider, ok := prev.(*uniformSlider)
+	if !ok || len(prevSlider.values) != len(self.values) { return }
+	if prevSlider.isInt != self.isInt { return }
+	for i, value := range prevSlider.values {
+		self.values[i] = self.quantize(value)
+	}
+}
+
+func (self *uniformSlider) quantize(value float64) float64 {
+	if self.step > 0 {
+		value = self.min + math.Round((value - self.min)/self.step)*self.step
+	}
+	return math.Max(self.min, math.Min(value, self.max))
+}
+
+func (self *uniformSlider) WidgetHeight() int {
+	return sliderLabelHeight + len(self.values)*(sliderBarHeight + sliderBarSpacing)
+}
+
+func (self *uniformSlider) Drag(rect image.Rectangle, x, y int, start bool) bool {
+	if start {
+		barsTop := rect.Min.Y + sliderLabelHeight
+		if y < barsTop { return false }
+		self.dragComponent = (y - barsTop)/(sliderBarHeight + sliderBarSpacing)
+		if self.dragComponent >= len(self.values) {
+			self.dragComponent = len(self.values) - 1
+		}
+	}
+
+	t := float64(x - rect.Min.X)/float64(rect.Dx())
+	t  = math.Max(0, math.Min(t, 1))
+	self.values[self.dragComponent] = self.quantize(self.min + t*(self.max - self.min))
+	return true
+}
+
+func (self *uniformSlider) DrawWidget(screen *ebiten.Image, rect image.Rectangle) {
+	ebitenutil.DebugPrintAt(screen, self.label(), rect.Min.X, rect.Min.Y)
+
+	// bars
+	y := rect.Min.Y + sliderLabelHeight
+	width := float32(rect.Dx())
+	for _, value := range self.values {
+		t := float32((value - self.min)/(self.max - self.min))
+		fx, fy := float32(rect.Min.X), float32(y)
+		vector.DrawFilledRect(screen, fx, fy, width, sliderBarHeight, panelTrackColor, false)
+		vector.DrawFilledRect(screen, fx, fy, width*t, sliderBarHeight, panelFillColor, false)
+		vector.DrawFilledRect(screen, fx + width*t - 1, fy - 1, 2, sliderBarHeight + 2, panelHandleColor, false)
+		y += sliderBarHeight + sliderBarSpacing
+	}
+}
+
+func (self *uniformSlider) label() string {
+	strs := make([]string, len(self.values))
+	for i, value := range self.values {
+		switch {
+		case self.isInt:
+			strs[i] = fmt.Sprintf("%d", int(math.Round(value)))
+		default:
+			strs[i] = fmt.Sprintf("%.2f", value)
+		}
+	}
+	if len(strs) == 1 { return self.name + ": " + strs[0] }
+	return self.name + ": (" + strings.Join(strs, ", ") + ")"
+}
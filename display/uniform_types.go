@@ -0,0 +1,149 @@
+package display
+
+import "fmt"
+import "sort"
+import "reflect"
+import "strconv"
+import "strings"
+
+// Returns the number of values and whether they are ints for the
+// given Kage uniform type name, like "vec3" or "[4]ivec2". Returns
+// 0 if the type is unknown.
+func uniformTypeSize(typeName string) (int, bool) {
+	if strings.HasPrefix(typeName, "[") {
+		end := strings.Index(typeName, "]")
+		if end == -1 { return 0, false }
+		length, err := strconv.Atoi(typeName[1 : end])
+		if err != nil || length < 0 { return 0, false }
+		size, isInt := uniformTypeSize(typeName[end + 1 : ])
+		return length*size, isInt
+	}
+
+	switch typeName {
+	case "mat2": return 4, false
+	case "mat3": return 9, false
+	case "mat4": return 16, false
+	default:
+		return uniformTypeComponents(typeName)
+	}
+}
+
+// Converts a uniform value to a value matching the given declared
+// type: ints become float32 for float types and slices or arrays of
+// other numeric types become []float32. Floats are not converted to
+// ints, as that would silently lose precision. Values for unknown
+// types are returned unmodified.
+func convertUniform(value any, typeName string) (any, error) {
+	size, isInt := uniformTypeSize(typeName)
+	if size == 0 { return value, nil }
+
+	reflectValue := reflect.ValueOf(value)
+	switch reflectValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if size != 1 { return nil, fmt.Errorf("expected %d values for %s, got a single %T", size, typeName, value) }
+		if isInt { return value, nil }
+		return float32(reflectValue.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if size != 1 { return nil, fmt.Errorf("expected %d values for %s, got a single %T", size, typeName, value) }
+		if isInt { return value, nil }
+		return float32(reflectValue.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if size != 1 { return nil, fmt.Errorf("expected %d values for %s, got a single %T", size, typeName, value) }
+		if isInt { return nil, fmt.Errorf("can't use %T value for %s", value, typeName) }
+		if reflectValue.Kind() == reflect.Float32 { return value, nil }
+		return float32(reflectValue.Float()), nil
+	case reflect.Slice, reflect.Array:
+		length := reflectValue.Len()
+		if length != size { return nil, fmt.Errorf("expected %d values for %s, got %d", size, typeName, length) }
+		switch reflectValue.Type().Elem().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		     reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if isInt { return value, nil }
+		case reflect.Float32:
+			if isInt { return nil, fmt.Errorf("can't use %T value for %s", value, typeName) }
+			return value, nil
+		case reflect.Float64:
+			if isInt { return nil, fmt.Errorf("can't use %T value for %s", value, typeName) }
+		default:
+			return nil, fmt.Errorf("unsupported %T value for %s", value, typeName)
+		}
+		floats := make([]float32, length)
+		for i := 0; i < length; i++ {
+			elem := reflectValue.Index(i)
+			switch {
+			case elem.CanInt()  : floats[i] = float32(elem.Int())
+			case elem.CanUint() : floats[i] = float32(elem.Uint())
+			case elem.CanFloat(): floats[i] = float32(elem.Float())
+			}
+		}
+		return floats, nil
+	default:
+		return nil, fmt.Errorf("unsupported %T value for %s", value, typeName)
+	}
+}
+
+// A uniform value that couldn't be converted to its declared type.
+type uniformError struct {
+	name string
+	err error
+}
+
+func (self *uniformError) Error() string {
+	return "uniform '" + self.name + "': " + self.err.Error()
+}
+
+// Converts the uniform values in place to the types declared by the
+// program. Values that can't be converted are removed, and their
+// errors are returned sorted by uniform name. Undeclared uniforms
+// are left untouched.
+func convertUniforms(uniforms map[string]any, declared map[string]string) []*uniformError {
+	var errs []*uniformError
+	for name, value := range uniforms {
+		typeName, found := declared[name]
+		if !found { continue }
+		converted, err := convertUniform(value, typeName)
+		if err != nil {
+			errs = append(errs, &uniformError{ name, err })
+			delete(uniforms, name)
+		} else {
+			uniforms[name] = converted
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].name < errs[j].name })
+	return errs
+}
+
+// Converts the uniforms on the shader options to their declared types,
+// and warns about values that can't be converted, uniforms that are
+// set but not declared by the program and declared uniforms that are
+// never set. Each warning is only shown once per program version.
+func (self *shaderDisplayer) checkUniforms() {
+	if self.uniformWarnings == nil { self.uniformWarnings = make(map[string]bool) }
+	warnOnce := func(key string, msg string) {
+		if self.uniformWarnings[key] { return }
+		self.uniformWarnings[key] = true
+		warn(msg)
+	}
+
+	errs := convertUniforms(self.options.Uniforms, self.declaredUniforms)
+	failed := make(map[string]bool, len(errs))
+	for _, err := range errs {
+		failed[err.name] = true
+	}
+	for name, _ := range self.options.Uniforms {
+		if _, found := self.declaredUniforms[name]; found { continue }
+		switch name {
+		case "Time", "Cursor", "MouseButtons":
+			continue // always set, regardless of the program
+		}
+		warnOnce("undeclared " + name, "uniform '" + name + "' is set but not declared by the shader")
+	}
+	for name, _ := range self.declaredUniforms {
+		if _, found := self.options.Uniforms[name]; found || failed[name] { continue }
+		warnOnce("unset " + name, "uniform '" + name + "' is declared by the shader but never set")
+	}
+	for _, err := range errs {
+		warnOnce(err.Error(), err.Error() + " (value ignored)")
+	}
+}
@@ -0,0 +1,67 @@
+package display
+
+import "reflect"
+import "strings"
+import "testing"
+
+func TestConvertUniform(t *testing.T) {
+	tests := []struct {
+		value any
+		typeName string
+		want any
+		errPart string // expected error substring, if any
+	}{
+		{ float32(1.5), "float", float32(1.5), "" },
+		{ 1.5, "float", float32(1.5), "" },
+		{ 2, "float", float32(2), "" },
+		{ uint8(3), "float", float32(3), "" },
+		{ 2, "int", 2, "" },
+		{ 2.5, "int", nil, "can't use float64 value for int" },
+		{ []float64{ 1, 2 }, "vec2", []float32{ 1, 2 }, "" },
+		{ [3]int{ 1, 2, 3 }, "vec3", []float32{ 1, 2, 3 }, "" },
+		{ []float32{ 1, 2, 3, 4 }, "vec4", []float32{ 1, 2, 3, 4 }, "" },
+		{ []int{ 1, 2 }, "ivec2", []int{ 1, 2 }, "" },
+		{ []float32{ 1, 2 }, "ivec2", nil, "can't use []float32 value for ivec2" },
+		{ []float32{ 1, 2 }, "vec3", nil, "expected 3 values for vec3, got 2" },
+		{ 1, "vec2", nil, "expected 2 values for vec2, got a single int" },
+		{ []int{ 1, 0, 0, 1 }, "mat2", []float32{ 1, 0, 0, 1 }, "" },
+		{ make([]float64, 9), "mat3", make([]float32, 9), "" },
+		{ make([]float32, 15), "mat4", nil, "expected 16 values for mat4, got 15" },
+		{ make([]int, 6), "[3]vec2", make([]float32, 6), "" },
+		{ make([]int, 8), "[4]ivec2", make([]int, 8), "" },
+		{ []string{ "x" }, "float", nil, "unsupported []string value for float" },
+		{ "x", "float", nil, "unsupported string value" },
+		{ "unknown type", "Custom", "unknown type", "" },
+	}
+	for _, test := range tests {
+		got, err := convertUniform(test.value, test.typeName)
+		if test.errPart != "" {
+			if err == nil || !strings.Contains(err.Error(), test.errPart) {
+				t.Errorf("%T %v as %s: expected error containing '%s', got %v", test.value, test.value, test.typeName, test.errPart, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%T %v as %s: unexpected error: %s", test.value, test.value, test.typeName, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%T %v as %s: got %T %v, want %T %v", test.value, test.value, test.typeName, got, got, test.want, test.want)
+		}
+	}
+}
+
+func TestConvertUniforms(t *testing.T) {
+	uniforms := map[string]any{ "Scale": 2, "Offset": 1.5, "Count": 0.5, "Extra": "kept" }
+	declared := map[string]string{ "Scale": "float", "Offset": "vec2", "Count": "int" }
+	errs := convertUniforms(uniforms, declared)
+
+	expected := map[string]any{ "Scale": float32(2), "Extra": "kept" }
+	if !reflect.DeepEqual(uniforms, expected) {
+		t.Errorf("expected uniforms %v, got %v", expected, uniforms)
+	}
+	if len(errs) != 2 || errs[0].name != "Count" || errs[1].name != "Offset" {
+		t.Fatalf("expected errors for Count and Offset, got %v", errs)
+	}
+	if !strings.HasPrefix(errs[0].Error(), "uniform 'Count': ") {
+		t.Errorf("unexpected error message '%s'", errs[0].Error())
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/tinne26/kage-desk/examples/misc/headless-test
+
+go 1.19
+
+// RunHeadless() is not part of the display version below yet, so this
+// example needs the go.work file at the root of the repository for now
+require github.com/tinne26/kage-desk/display v0.0.0-20240606194240-419b91db2465
+
+require (
+	github.com/ebitengine/gomobile v0.0.0-20240518074828-e86332849895 // indirect
+	github.com/ebitengine/hideconsole v1.0.0 // indirect
+	github.com/ebitengine/purego v0.7.0 // indirect
+	github.com/hajimehoshi/ebiten/v2 v2.7.4 // indirect
+	github.com/jezek/xgb v1.1.1 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+)
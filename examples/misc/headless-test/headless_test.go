@@ -0,0 +1,65 @@
+package headless
+
+import "os"
+import "image"
+import "testing"
+import "image/color"
+
+import "github.com/tinne26/kage-desk/display"
+import "github.com/tinne26/kage-desk/display/kagecpu"
+
+// Usage: go test (or xvfb-run go test on machines without a display)
+
+var tintProgram = []byte(`//kage:unit pixels
+package main
+
+var Tint vec3
+
+func Fragment(targetCoords vec4, srcPos vec2, color vec4) vec4 {
+	return vec4(Tint, 1)
+}
+`)
+
+// RenderShaderToImage() needs an Ebitengine game loop running on the
+// main goroutine, so the tests are run from RunHeadless().
+func TestMain(m *testing.M) {
+	os.Exit(display.RunHeadless(m.Run))
+}
+
+func TestTint(t *testing.T) {
+	uniforms := map[string]any{ "Tint": []float64{ 1, 0.2, 0 } } // (converted to []float32)
+	img, err := display.RenderShaderToImage(tintProgram, 16, 16, uniforms, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+
+	expected := color.RGBA{ 255, 51, 0, 255 }
+	if img.RGBAAt(8, 8) != expected {
+		t.Fatalf("expected %v, got %v", expected, img.RGBAAt(8, 8))
+	}
+}
+
+// Results are the raw shader outputs, not composited over any background.
+func TestTranslucent(t *testing.T) {
+	program := []byte("package main\nfunc Fragment(dst vec4, src vec2, color vec4) vec4 {\n\treturn vec4(0.25, 0, 0, 0.5)\n}\n")
+	img, err := display.RenderShaderToImage(program, 4, 4, nil, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+
+	expected := color.RGBA{ 64, 0, 0, 128 }
+	if img.RGBAAt(2, 2) != expected {
+		t.Fatalf("expected %v, got %v", expected, img.RGBAAt(2, 2))
+	}
+}
+
+// The CPU interpreter doesn't need RunHeadless() nor a display,
+// and can be used to cross-check the GPU results.
+func TestTintCPU(t *testing.T) {
+	program, err := kagecpu.Compile(tintProgram)
+	if err != nil { t.Fatal(err) }
+	uniforms := map[string]any{ "Tint": []float32{ 1, 0.2, 0 } }
+	img, err := program.Render(16, 16, uniforms, [4]image.Image{})
+	if err != nil { t.Fatal(err) }
+
+	expected := color.RGBA{ 255, 51, 0, 255 }
+	if img.RGBAAt(8, 8) != expected {
+		t.Fatalf("expected %v, got %v", expected, img.RGBAAt(8, 8))
+	}
+}
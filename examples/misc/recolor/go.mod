@@ -2,13 +2,21 @@ module github.com/tinne26/kage-desk/examples/misc/recolor
 
 go 1.19
 
-require github.com/hajimehoshi/ebiten/v2 v2.7.4
+// LinkShaderImageFile() and LinkUniformColor() are not part of the display
+// version below yet, so the replace at the end points to the local display
+// package instead. If you copy this example elsewhere, point the replace to
+// your own copy of the display package, or drop it once a newer version is out
+require github.com/tinne26/kage-desk/display v0.0.0-20240606194240-419b91db2465
 
 require (
 	github.com/ebitengine/gomobile v0.0.0-20240518074828-e86332849895 // indirect
 	github.com/ebitengine/hideconsole v1.0.0 // indirect
 	github.com/ebitengine/purego v0.7.0 // indirect
+	github.com/hajimehoshi/ebiten/v2 v2.7.4 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
+	golang.org/x/image v0.16.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 )
+
+replace github.com/tinne26/kage-desk/display => ../../../display
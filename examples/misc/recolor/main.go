@@ -1,72 +1,58 @@
 package main
 
 import "os"
-import "fmt"
 import "log"
+import "image"
+import "strings"
 import _ "embed"
-import "image/png"
+import "image/color"
 
-import "github.com/hajimehoshi/ebiten/v2"
+import "github.com/tinne26/kage-desk/display"
 
 //go:embed shader.kage
 var shaderProgram []byte
 
-var darkColor  = []float32{0.1, 0.0, 0.0, 1.0}
-var lightColor = []float32{0.2, 1.0, 1.0, 1.0}
-var image *ebiten.Image
-var horzResolution, vertResolution int
-
+// Usage: go run main.go path/to/source.png
+// (or go run main.go --img0=path/to/source.png)
 func main() {
-	// load image from arguments
-	if len(os.Args) != 2 {
-		fmt.Printf("Usage: go run main.go path/to/source.png\n")
-		os.Exit(1)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "--") {
+		display.LinkShaderImageFile(0, os.Args[1])
 	}
-	file, err := os.Open(os.Args[1])
-	if err != nil { log.Fatal(err) }
-	defer file.Close() // ignoring close error
-	img, err := png.Decode(file)
-	if err != nil { log.Fatal(err) }
-	image = ebiten.NewImageFromImage(img)
-	bounds := image.Bounds()
-	horzResolution, vertResolution = bounds.Dx(), bounds.Dy()
 
-	// compile the shader
-	shader, err := ebiten.NewShader(shaderProgram)
-	if err != nil { log.Fatal(err) }
-
-	// create game struct
-	game := &Game{ shader: shader }
+	// use the image size as the layout so it's not stretched
+	width, height := 384, 384 // default image size
+	path := sourceImagePath()
+	if path != "" { width, height = imageSize(path) }
 
-	// configure window and run game
-	ebiten.SetWindowTitle("examples/misc/recolor")
-	ebiten.SetWindowSize(512, 512)
-	err = ebiten.RunGame(game)
-	if err != nil { log.Fatal(err) }
+	display.SetTitle("examples/misc/recolor")
+	display.SetSize(width, height, display.Resizable)
+	display.LinkUniformColor("DarkColor", color.RGBA{26, 0, 0, 255})
+	display.LinkUniformColor("LightColor", color.RGBA{51, 255, 255, 255})
+	display.Shader(shaderProgram)
 }
 
-// Struct implementing the ebiten.Game interface.
-type Game struct {
-	shader *ebiten.Shader
-}
-
-// Assume a fixed layout.
-func (self *Game) Layout(_, _ int) (int, int) {
-	return horzResolution, vertResolution
+// Returns the path given as the first argument or through the
+// --img0 flag, or an empty string if none.
+func sourceImagePath() string {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "--") {
+		return os.Args[1]
+	}
+	for _, arg := range os.Args[1 : ] {
+		if strings.HasPrefix(arg, "--img0=") {
+			return strings.TrimPrefix(arg, "--img0=")
+		}
+	}
+	return ""
 }
 
-// No logic to update.
-func (self *Game) Update() error { return nil }
-
-// Core drawing function from where we call DrawRectShader.
-func (self *Game) Draw(screen *ebiten.Image) {
-	// create draw options
-	opts := &ebiten.DrawRectShaderOptions{}
-	opts.Uniforms = make(map[string]interface{})
-	opts.Uniforms["DarkColor"]  = darkColor
-	opts.Uniforms["LightColor"] = lightColor
-	opts.Images[0] = image
-	
-	// draw shader
-	screen.DrawRectShader(horzResolution, vertResolution, self.shader, opts)
+// Returns the size of the image without fully decoding it. The
+// display package registers the decoders for all the formats it
+// supports.
+func imageSize(path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil { log.Fatal(err) }
+	defer file.Close() // ignoring close error
+	config, _, err := image.DecodeConfig(file)
+	if err != nil { log.Fatal(err) }
+	return config.Width, config.Height
 }